@@ -0,0 +1,165 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Batch is a list of requests sent to the server in a single HTTP
+// request as a JSON array, as supported by Apollo Server.
+type Batch struct {
+	requests []*Request
+
+	// Header represent any request headers that will be set
+	// when the batch request is made.
+	Header http.Header
+}
+
+// NewBatch makes a new Batch holding the requests.
+func NewBatch(reqs ...*Request) *Batch {
+	return &Batch{
+		requests: reqs,
+		Header:   make(map[string][]string),
+	}
+}
+
+// Add adds a request to the batch.
+func (b *Batch) Add(req *Request) {
+	b.requests = append(b.requests, req)
+}
+
+// Requests gets the requests in this batch.
+func (b *Batch) Requests() []*Request {
+	return b.requests
+}
+
+// RunBatch executes the requests of the batch in a single HTTP request
+// and unmarshals the data field of each result into the response object
+// at the same index of resps. A nil response object skips parsing of
+// that result.
+// The returned slice holds the error of each request, so one failed
+// operation doesn't discard the results of the others. The error is
+// non-nil when the batch as a whole failed.
+// Files are not supported in batches.
+func (c *Client) RunBatch(ctx context.Context, batch *Batch, resps []interface{}) ([]error, error) {
+	ctx = withRequestID(ctx)
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	select {
+	case <-ctx.Done():
+		return nil, contextError(ctx, ctx.Err())
+	default:
+	}
+	if err := c.configErr; err != nil {
+		return nil, err
+	}
+	if err := c.schemaVersion.err(); err != nil {
+		return nil, err
+	}
+	if len(resps) != len(batch.requests) {
+		return nil, fmt.Errorf("graphql: batch has %d requests but %d responses", len(batch.requests), len(resps))
+	}
+	type batchItem struct {
+		Query         string      `json:"query,omitempty"`
+		DocumentID    string      `json:"documentId,omitempty"`
+		Variables     interface{} `json:"variables"`
+		OperationName string      `json:"operationName,omitempty"`
+	}
+	items := make([]batchItem, len(batch.requests))
+	logged := make([]batchItem, len(batch.requests))
+	for i, req := range batch.requests {
+		if len(req.files) > 0 {
+			return nil, errors.New("cannot send files in a batch")
+		}
+		req = req.runCopy()
+		if err := c.resolveDocument(req); err != nil {
+			return nil, err
+		}
+		if err := c.rewriteRequest(req); err != nil {
+			return nil, err
+		}
+		items[i] = batchItem{
+			DocumentID:    req.documentID,
+			Variables:     req.variables(),
+			OperationName: req.OpName,
+		}
+		if req.documentID == "" {
+			items[i].Query = req.q
+		}
+		logged[i] = items[i]
+		logged[i].Variables = c.redactVariables(req.variableMap())
+	}
+	var requestBody bytes.Buffer
+	if err := c.encodeJSON(&requestBody, items); err != nil {
+		return nil, errors.Wrap(err, "encode body")
+	}
+	loggedBody, _ := json.Marshal(logged)
+	c.logf(ctx, ">> batch: %s", loggedBody)
+
+	req := &Request{
+		Header:      batch.Header,
+		method:      http.MethodPost,
+		body:        requestBody,
+		contentType: "application/json; charset=utf-8",
+	}
+	endpoint, err := c.resolveEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	req.url = endpoint
+	header, err := c.requestHeader(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	res, body, failedAttempt, err := c.send(ctx, req, header)
+	if err != nil {
+		return nil, contextError(ctx, retryError(failedAttempt, err))
+	}
+	c.logf(ctx, "<< %s", string(body))
+	c.schemaVersion.observe(res.Header)
+	if err := c.validate(res, body); err != nil {
+		return nil, err
+	}
+	errs, err := c.decodeBatch(res, body, resps)
+	if err != nil {
+		return nil, retryError(failedAttempt, err)
+	}
+	return errs, nil
+}
+
+// decodeBatch decodes the results of a batch into resps, returning
+// the error of each result.
+func (c *Client) decodeBatch(res *http.Response, body []byte, resps []interface{}) ([]error, error) {
+	var results []json.RawMessage
+	if err := json.Unmarshal(body, &results); err != nil {
+		if res.StatusCode != http.StatusOK {
+			return nil, &StatusError{StatusCode: res.StatusCode, Body: body}
+		}
+		return nil, &DecodeError{Body: body, Err: err}
+	}
+	if len(results) != len(resps) {
+		return nil, fmt.Errorf("graphql: server returned %d results for %d requests", len(results), len(resps))
+	}
+	errs := make([]error, len(results))
+	for i := range results {
+		gr := &graphResponse{Data: resps[i]}
+		result := c.standardKeys(results[i])
+		if err := c.decodeJSON(bytes.NewReader(result), gr); err != nil {
+			errs[i] = &DecodeError{Body: results[i], Err: err}
+			continue
+		}
+		setRawErrors(result, gr.Errors)
+		if len(gr.Errors) > 0 {
+			errs[i] = gr.Errors
+		}
+	}
+	return errs, nil
+}
@@ -0,0 +1,165 @@
+package graphql
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithResponseCache keeps the successful responses of queries in memory
+// for ttl, and serves identical queries from it without sending them.
+// Queries are identical when they are sent to the same endpoint with the
+// same body and headers, including credentials, so users and tenants
+// never share responses. Mutations, subscriptions, requests with files
+// and all requests of clients using WithRequestMutator are never cached,
+// and neither are responses with errors. The least recently used
+// response is evicted when there are more than maxEntries, unless
+// maxEntries is 0. A ttl of zero or less disables the cache.
+// ResponseMeta.FromCache is set for responses served from the cache.
+func WithResponseCache(ttl time.Duration, maxEntries int) ClientOption {
+	return func(client *Client) {
+		client.cache = nil
+		if ttl > 0 {
+			client.cache = newResponseCache(ttl, maxEntries)
+		}
+	}
+}
+
+// WithETags makes the queries sent as GET requests with
+// UseGETForQueries conditional: the ETag of their last response is sent
+// in the If-None-Match header, and when the server answers 304 Not
+// Modified the body of that response is decoded again. Like with
+// WithResponseCache, requests are only the same when they have the same
+// URL and headers, including credentials, and requests of clients using
+// WithRequestMutator are not made conditional. The responses of up to
+// maxEntries different requests are kept, evicting the least recently
+// used, unless maxEntries is 0.
+// ResponseMeta.FromCache is set for responses that were not modified,
+// and StatusCode is 304.
+func WithETags(maxEntries int) ClientOption {
+	return func(client *Client) {
+		client.etags = newResponseCache(0, maxEntries)
+	}
+}
+
+// responseCache is an LRU cache of responses.
+type responseCache struct {
+	// ttl is how long entries are kept, or forever when 0
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds the entries, the most recently used first
+	lru *list.List
+}
+
+func newResponseCache(ttl time.Duration, maxEntries int) *responseCache {
+	return &responseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	key     string
+	body    []byte
+	meta    ResponseMeta
+	etag    string
+	expires time.Time
+}
+
+func (rc *responseCache) get(key string) (*cacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if rc.ttl > 0 && time.Now().After(entry.expires) {
+		rc.lru.Remove(el)
+		delete(rc.entries, key)
+		return nil, false
+	}
+	rc.lru.MoveToFront(el)
+	return entry, true
+}
+
+func (rc *responseCache) add(entry *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if el, ok := rc.entries[entry.key]; ok {
+		rc.lru.Remove(el)
+	}
+	rc.entries[entry.key] = rc.lru.PushFront(entry)
+	for rc.maxEntries > 0 && rc.lru.Len() > rc.maxEntries {
+		oldest := rc.lru.Back()
+		rc.lru.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// etagKey gets the key of the encoded request in the ETag cache, or
+// false when the request isn't made conditional. Like the key of the
+// response cache, it covers the headers of the request, so a response
+// is never revalidated with other credentials.
+func (c *Client) etagKey(req *Request, header http.Header) (string, bool) {
+	if c.etags == nil || req.noCache || c.requestMutator != nil || req.method != http.MethodGet {
+		return "", false
+	}
+	return flightKey(req, header), true
+}
+
+// storeETag keeps the response in the ETag cache when it has an ETag.
+func (c *Client) storeETag(key string, res *http.Response, body []byte) {
+	if res.StatusCode != http.StatusOK {
+		return
+	}
+	if etag := res.Header.Get("ETag"); etag != "" {
+		c.etags.add(&cacheEntry{key: key, body: body, etag: etag})
+	}
+}
+
+// cacheKey gets the key of the encoded request in the response cache,
+// or false when the request can't be cached. The key covers the method,
+// URL, headers and body of the request, so requests sent to other
+// endpoints or with other credentials don't share responses.
+func (c *Client) cacheKey(req *Request, header http.Header) (string, bool) {
+	if c.cache == nil || req.noCache || c.requestMutator != nil || len(req.files) > 0 || req.writeBody != nil || req.operationType() != "query" {
+		return "", false
+	}
+	return flightKey(req, header), true
+}
+
+// cachedResponse decodes the response of the request from the response
+// cache of the client, reporting whether it was there.
+func (c *Client) cachedResponse(ctx context.Context, key string, gr *graphResponse) (bool, error) {
+	entry, ok := c.cache.get(key)
+	if !ok {
+		return false, nil
+	}
+	c.logf(ctx, "<< served from the response cache")
+	meta := entry.meta
+	meta.Header = entry.meta.Header.Clone()
+	meta.FromCache = true
+	gr.meta = &meta
+	gr.raw = entry.body
+	res := &http.Response{StatusCode: meta.StatusCode, Header: meta.Header}
+	return true, c.decode(res, entry.body, gr)
+}
+
+// storeResponse keeps the response of the request in the response cache.
+func (c *Client) storeResponse(key string, gr *graphResponse) {
+	if gr.meta.StatusCode != http.StatusOK {
+		return
+	}
+	meta := *gr.meta
+	meta.Header = gr.meta.Header.Clone()
+	c.cache.add(&cacheEntry{key: key, body: gr.raw, meta: meta, expires: time.Now().Add(c.cache.ttl)})
+}
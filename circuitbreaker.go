@@ -0,0 +1,116 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithCircuitBreaker stops sending requests to a failing server. After
+// failureThreshold consecutive requests failed with a network error or a
+// 5xx status code, the circuit opens and requests fail right away with
+// a CircuitOpenError. Once resetTimeout has elapsed, a single request is
+// sent as a probe: the circuit closes when it succeeds, and opens again
+// when it fails.
+// Retries of a request count as a single request, and requests cancelled
+// by the caller are not counted.
+func WithCircuitBreaker(failureThreshold int, resetTimeout time.Duration) ClientOption {
+	return func(client *Client) {
+		if failureThreshold < 1 {
+			client.breaker = nil
+			return
+		}
+		client.breaker = &circuitBreaker{threshold: failureThreshold, resetTimeout: resetTimeout}
+	}
+}
+
+// CircuitOpenError is returned by clients using WithCircuitBreaker when
+// a request was not sent because the circuit is open.
+type CircuitOpenError struct {
+	// Until is when a request will be sent again to probe the server.
+	Until time.Time
+}
+
+// Error implements error interface
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("graphql: circuit open until %s", e.Until.Format(time.RFC3339))
+}
+
+// circuitBreaker counts the consecutive failed requests. The circuit is
+// open when they reach the threshold.
+type circuitBreaker struct {
+	threshold    int
+	resetTimeout time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+type circuitResult int
+
+const (
+	circuitSuccess circuitResult = iota
+	circuitFailure
+	circuitIgnored
+)
+
+// allow reports whether a request can be sent, and whether it is the
+// probe of an open circuit.
+func (b *circuitBreaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return false, nil
+	}
+	until := b.openedAt.Add(b.resetTimeout)
+	if b.probing || time.Now().Before(until) {
+		return false, &CircuitOpenError{Until: until}
+	}
+	b.probing = true
+	return true, nil
+}
+
+// record records the result of a request allowed by allow.
+func (b *circuitBreaker) record(probe bool, result circuitResult) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch result {
+	case circuitSuccess:
+		b.failures = 0
+	case circuitFailure:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openedAt = time.Now()
+		}
+	}
+}
+
+// circuitResultOf classifies the outcome of sending a request.
+func circuitResultOf(ctx context.Context, res *http.Response, err error) circuitResult {
+	if err != nil {
+		var netErr *NetworkError
+		if errors.As(err, &netErr) && ctx.Err() != context.Canceled {
+			return circuitFailure
+		}
+		return circuitIgnored
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		return circuitFailure
+	}
+	return circuitSuccess
+}
@@ -0,0 +1,419 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StatusError is returned when the server responds with a status code
+// other than 200 OK.
+type StatusError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Body is the raw response body.
+	Body []byte
+	// Errors holds the GraphQL errors when the body could be decoded
+	// and reported any.
+	Errors Errors
+}
+
+// Error implements error interface
+func (e *StatusError) Error() string {
+	if len(e.Errors) > 0 {
+		return e.Errors.Error()
+	}
+	return fmt.Sprintf("graphql: server returned a non-200 status code: %v", e.StatusCode)
+}
+
+// Unwrap returns the GraphQL errors reported in the body, if any.
+func (e *StatusError) Unwrap() error {
+	if len(e.Errors) > 0 {
+		return e.Errors
+	}
+	return nil
+}
+
+// NetworkError is returned when the request could not be sent or its
+// response could not be read, for example because the connection failed
+// or the context was cancelled.
+type NetworkError struct {
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error interface
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("graphql: network error: %v", e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned when a response was received but its body
+// could not be decoded, such as an HTML page or a truncated body.
+type DecodeError struct {
+	// Body is the body that could not be decoded.
+	Body []byte
+	// Err is the error of the decoder.
+	Err error
+}
+
+// Error implements error interface
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("graphql: decoding response: %v", e.Err)
+}
+
+// Unwrap returns the error of the decoder.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// RequestError is returned by clients using UseGraphQLResponseJSON when
+// the server rejected the request with a 4xx status code, for example
+// because the query failed validation. Sending the same request again
+// would fail the same way.
+type RequestError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Errors holds the GraphQL errors reported by the server.
+	Errors Errors
+}
+
+// Error implements error interface
+func (e *RequestError) Error() string {
+	if len(e.Errors) > 0 {
+		return e.Errors.Error()
+	}
+	return fmt.Sprintf("graphql: request rejected with status code %v", e.StatusCode)
+}
+
+// Unwrap returns the GraphQL errors reported by the server, if any.
+func (e *RequestError) Unwrap() error {
+	if len(e.Errors) > 0 {
+		return e.Errors
+	}
+	return nil
+}
+
+// ResponseTooLargeError is returned when a response body exceeds the
+// limit set with WithMaxResponseBytes or WithResponseLimits.
+type ResponseTooLargeError struct {
+	// Limit is the maximum size of response bodies, in bytes.
+	Limit int64
+}
+
+// Error implements error interface
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("graphql: response too large: exceeds %d bytes", e.Limit)
+}
+
+// PartialError is returned by clients using WithPartialData when the
+// server reported errors alongside non-null data. The response object
+// holds the data that could be resolved.
+type PartialError struct {
+	// Errors holds the GraphQL errors reported by the server.
+	Errors Errors
+	// Data is the raw data field of the response.
+	Data json.RawMessage
+}
+
+// Error implements error interface
+func (e *PartialError) Error() string {
+	return e.Errors.Error()
+}
+
+// Unwrap returns the GraphQL errors reported by the server.
+func (e *PartialError) Unwrap() error {
+	return e.Errors
+}
+
+// TimeoutError is returned when a request didn't complete in time: the
+// deadline of its context or the timeout set with WithTimeout passed, or
+// the HTTP client timed out.
+type TimeoutError struct {
+	// Err is the underlying error, such as context.DeadlineExceeded.
+	Err error
+}
+
+// Error implements error interface
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("graphql: timeout: %v", e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError is returned when the context of a request was cancelled
+// before the request completed.
+type CanceledError struct {
+	// Err is the underlying error, such as context.Canceled.
+	Err error
+}
+
+// Error implements error interface
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("graphql: canceled: %v", e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// contextError wraps err in a TimeoutError or a CanceledError when it
+// was caused by ctx being done or by a timeout of the HTTP client.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var timeout *TimeoutError
+	var canceled *CanceledError
+	if errors.As(err, &timeout) || errors.As(err, &canceled) {
+		return err
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		if ctxErr == context.DeadlineExceeded {
+			return &TimeoutError{Err: err}
+		}
+		return &CanceledError{Err: err}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &TimeoutError{Err: err}
+	}
+	return err
+}
+
+// ForPath gets the errors whose path starts with the given path segments.
+// Field names are given as strings and list indexes as ints.
+//  errs.ForPath("hero", "heroFriends", 1)
+func (l Errors) ForPath(path ...interface{}) []Error {
+	var result []Error
+	for _, e := range l {
+		if hasPathPrefix(e.Path, path) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// HasExtensionCode reports whether any of the errors carries the given
+// extensions.code, such as UNAUTHENTICATED or BAD_USER_INPUT.
+func (l Errors) HasExtensionCode(code string) bool {
+	for _, e := range l {
+		if e.Code() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorCode is an extensions.code of GraphQL errors, such as
+// UNAUTHENTICATED. With errors.Is, an error returned by Run matches an
+// ErrorCode when any of its GraphQL errors has that code.
+//  if errors.Is(err, graphql.ErrUnauthenticated) {
+//      // refresh the token
+//  }
+// Codes without a sentinel can be matched with their own ErrorCode, like
+// graphql.ErrorCode("RATE_LIMITED").
+type ErrorCode string
+
+// Sentinels of common codes, matched with errors.Is.
+var (
+	ErrUnauthenticated     = ErrorCode("UNAUTHENTICATED")
+	ErrForbidden           = ErrorCode("FORBIDDEN")
+	ErrBadUserInput        = ErrorCode("BAD_USER_INPUT")
+	ErrInternalServerError = ErrorCode("INTERNAL_SERVER_ERROR")
+)
+
+// Error implements error interface
+func (c ErrorCode) Error() string {
+	return "graphql: error code " + string(c)
+}
+
+// Is reports whether any of the errors has the code of target, when it
+// is an ErrorCode.
+func (l Errors) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && code != "" && l.HasExtensionCode(string(code))
+}
+
+// Is reports whether the error has the code of target, when it is an
+// ErrorCode.
+func (e Error) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && code != "" && e.Code() == string(code)
+}
+
+// Code gets extensions.code of the error, such as UNAUTHENTICATED, or
+// an empty string.
+func (e Error) Code() string {
+	code, _ := e.ExtensionString("code")
+	return code
+}
+
+// Extension gets the value of the extension at key, which can be a dotted
+// path into nested objects such as "exception.stacktrace".
+func (e Error) Extension(key string) (interface{}, bool) {
+	var value interface{} = e.Extensions
+	for _, segment := range strings.Split(key, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[segment]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// ExtensionString gets the extension at key, as for Extension, when it
+// is a string.
+func (e Error) ExtensionString(key string) (string, bool) {
+	value, _ := e.Extension(key)
+	s, ok := value.(string)
+	return s, ok
+}
+
+// ExtensionInt gets the extension at key, as for Extension, when it is
+// an integer number.
+func (e Error) ExtensionInt(key string) (int64, bool) {
+	value, _ := e.Extension(key)
+	switch n := value.(type) {
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n), true
+		}
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, true
+		}
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+// FormatLocation formats the locations of the error in query, the query
+// the error was reported for, as the offending line with a caret under
+// the column, like compilers do:
+//  2 |   heroo {
+//    |   ^
+// Locations outside of query are formatted as line:column.
+func (e Error) FormatLocation(query string) string {
+	lines := strings.Split(lineTerminators.Replace(query), "\n")
+	var b strings.Builder
+	for i, loc := range e.Locations {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if loc.Line < 1 || loc.Line > len(lines) || loc.Column < 1 {
+			fmt.Fprintf(&b, "%d:%d", loc.Line, loc.Column)
+			continue
+		}
+		line := lines[loc.Line-1]
+		gutter := strconv.Itoa(loc.Line)
+		fmt.Fprintf(&b, "%s | %s\n%s | %s^", gutter, line, strings.Repeat(" ", len(gutter)), caretIndent(line, loc.Column))
+	}
+	return b.String()
+}
+
+// FormatError formats the error reported for req with the snippets of its
+// locations, in the query as sent after WithQueryTransform.
+func (c *Client) FormatError(req *Request, e Error) string {
+	if len(e.Locations) == 0 {
+		return e.Error()
+	}
+	query := req.q
+	if c.queryTransform != nil {
+		if q, err := c.queryTransform(query); err == nil {
+			query = q
+		}
+	}
+	return e.Error() + "\n" + e.FormatLocation(query)
+}
+
+// lineTerminators normalizes the line terminators of GraphQL documents.
+var lineTerminators = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// caretIndent gets the indentation that puts a caret under the column,
+// counted in characters from 1, of line. Tabs are kept so the caret
+// lines up however they are displayed.
+func caretIndent(line string, column int) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range line {
+		if n == column-1 {
+			break
+		}
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+		n++
+	}
+	for ; n < column-1; n++ {
+		b.WriteRune(' ')
+	}
+	return b.String()
+}
+
+func hasPathPrefix(path, prefix []interface{}) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if !pathSegmentEqual(path[i], prefix[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathSegmentEqual compares path segments, treating list indexes
+// decoded from JSON as float64 or json.Number and given by callers as
+// ints alike. Segments of any other type are never equal.
+func pathSegmentEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	default:
+		x, ok := pathIndex(a)
+		if !ok {
+			return false
+		}
+		y, ok := pathIndex(b)
+		return ok && x == y
+	}
+}
+
+func pathIndex(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
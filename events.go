@@ -0,0 +1,62 @@
+package graphql
+
+import "time"
+
+// Event describes a run of the client, for tools showing the traffic of
+// the client as it happens.
+type Event struct {
+	// Operation is the name of the operation, as given by
+	// Request.OperationName.
+	Operation string
+	Query     string
+	// Variables holds the variables of the request, redacted like the
+	// variables logged with Log.
+	Variables map[string]interface{}
+	// Start is when the run started, and Duration how long it took,
+	// including retries.
+	Start    time.Time
+	Duration time.Duration
+	// StatusCode is the HTTP status code of the response, or 0 when no
+	// response was received.
+	StatusCode int
+	// ResponseBytes is the size of the response body, after
+	// decompression.
+	ResponseBytes int
+	// Err is the error returned by the run, if any.
+	Err error
+}
+
+// WithEventChannel sends an Event to ch at the end of every run of the
+// client. Events are dropped when ch is full rather than holding up the
+// requests, so give it a buffer large enough for the traffic.
+//  events := make(chan graphql.Event, 100)
+//  NewClient(endpoint, WithEventChannel(events))
+func WithEventChannel(ch chan<- Event) ClientOption {
+	return func(client *Client) {
+		client.events = ch
+	}
+}
+
+// sendEvent sends the event of a run to the event channel, unless it
+// is full.
+func (c *Client) sendEvent(req *Request, gr *graphResponse, start time.Time, dur time.Duration, err error) {
+	if c.events == nil {
+		return
+	}
+	e := Event{
+		Operation:     req.OperationName(),
+		Query:         req.q,
+		Variables:     c.redactVariables(req.variableMap()),
+		Start:         start,
+		Duration:      dur,
+		ResponseBytes: len(gr.raw),
+		Err:           err,
+	}
+	if gr.meta != nil {
+		e.StatusCode = gr.meta.StatusCode
+	}
+	select {
+	case c.events <- e:
+	default:
+	}
+}
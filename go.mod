@@ -3,7 +3,7 @@ module github.com/ikozinov/graphql
 go 1.14
 
 require (
+	github.com/gorilla/websocket v1.5.0
 	github.com/matryer/is v1.3.0
 	github.com/pkg/errors v0.9.1
-	github.com/stretchr/testify v1.5.1
 )
@@ -32,14 +32,26 @@ package graphql
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -47,15 +59,122 @@ import (
 // Client is a client for interacting with a GraphQL API.
 type Client struct {
 	endpoint         string
+	endpointResolver func(ctx context.Context, req *Request) (string, error)
 	httpClient       *http.Client
-	useMultipartForm bool
+	cookieJar        http.CookieJar
+	proxy            *url.URL
+	insecureTLS      bool
+	http2            bool
+	fileUploadMode   FileUploadMode
 
-	useMultipartRequestSpec bool
+	// multipartOperationsField and multipartMapField replace the names of
+	// the operations and map fields of FileUploadSpec when not empty
+	multipartOperationsField string
+	multipartMapField        string
+	// multipartBoundary separates the parts of multipart bodies when
+	// not empty
+	multipartBoundary string
+
+	useGraphQLContentType bool
+
+	useGraphQLResponseJSON bool
 
 	// closeReq will close the request body immediately allowing for reuse of client
 	closeReq bool
 
-	// Log is called with various debug information.
+	// timeout bounds every run when not zero
+	timeout time.Duration
+
+	// header is set on every request made by the client
+	header            http.Header
+	tokenProvider     func(ctx context.Context) (string, error)
+	headerFromContext func(ctx context.Context) http.Header
+	// operationNameHeader is set by WithOperationNameHeader
+	operationNameHeader string
+	// apiKeyHeader is the canonical name of the header set by WithAPIKey
+	apiKeyHeader string
+
+	persistedQueries bool
+	// trustedDocuments maps document IDs to queries, and
+	// trustedDocumentIDs queries to document IDs
+	trustedDocuments   map[string]string
+	trustedDocumentIDs map[string]string
+
+	localVariableCheck bool
+
+	queryTransform func(q string) (string, error)
+	baseVariables  map[string]interface{}
+
+	partialData bool
+
+	// dataKey and errorsKey replace the data and errors keys of results
+	// when not empty
+	dataKey   string
+	errorsKey string
+	// responseEnvelope is the path of results in responses when not empty
+	responseEnvelope string
+
+	methodOverride bool
+
+	validateResponse func(res *http.Response) error
+
+	requestMutator func(r *http.Request) error
+
+	subscriptionInitPayload map[string]interface{}
+
+	middleware []Middleware
+
+	encodeJSON func(w io.Writer, v interface{}) error
+	decodeJSON func(r io.Reader, v interface{}) error
+
+	useGETForQueries bool
+	getMaxURLLength  int
+	// queryMethod and mutationMethod are set by WithMethods
+	queryMethod    string
+	mutationMethod string
+
+	compressRequests bool
+	compressMinBytes int
+
+	retry retryPolicy
+	// replayMemoryLimit is set by WithReplayableBody
+	replayMemoryLimit int64
+
+	structuredLog func(LogEntry)
+	logger        func(ctx context.Context, s string)
+	logRedaction  func(key string, value interface{}) interface{}
+
+	// maxResponseBytes limits the size of response bodies when positive
+	maxResponseBytes int64
+	// noGzip asks for uncompressed responses and rejects gzipped ones
+	noGzip bool
+
+	uploadProgress   func(bytesTransferred, totalBytes int64)
+	downloadProgress func(bytesTransferred, totalBytes int64)
+
+	metrics Metrics
+	stats   *statsCollector
+	events  chan<- Event
+
+	flights *flightGroup
+	cache   *responseCache
+	etags   *responseCache
+
+	// runAllConcurrency limits the requests run at once by RunAll when
+	// not zero
+	runAllConcurrency int
+
+	breaker     *circuitBreaker
+	rateLimiter *rateLimiter
+
+	// configErr is the error of an invalid option, returned by Err and
+	// by every run
+	configErr error
+
+	schemaVersion *schemaVersionCheck
+
+	// Log is called with various debug information, prefixed with the
+	// ID of the request in brackets.
 	// To log to standard out, use:
 	//  client.Log = func(s string) { log.Println(s) }
 	Log func(s string)
@@ -64,8 +183,14 @@ type Client struct {
 // NewClient makes a new Client capable of making GraphQL requests.
 func NewClient(endpoint string, opts ...ClientOption) *Client {
 	c := &Client{
-		endpoint: endpoint,
-		Log:      func(string) {},
+		endpoint:         endpoint,
+		getMaxURLLength:  defaultGETMaxURLLength,
+		compressMinBytes: defaultCompressMinBytes,
+		encodeJSON:       encodeJSON,
+		decodeJSON:       decodeJSON,
+		metrics:          nopMetrics{},
+		logRedaction:     DefaultLogRedaction,
+		Log:              func(string) {},
 	}
 	for _, optionFunc := range opts {
 		optionFunc(c)
@@ -73,292 +198,1762 @@ func NewClient(endpoint string, opts ...ClientOption) *Client {
 	if c.httpClient == nil {
 		c.httpClient = http.DefaultClient
 	}
+	if c.cookieJar != nil {
+		// the http.Client may be shared, such as http.DefaultClient
+		httpClient := *c.httpClient
+		httpClient.Jar = c.cookieJar
+		c.httpClient = &httpClient
+	}
+	if c.proxy != nil && c.configErr == nil {
+		httpClient, ok := withTransport(c.httpClient, func(transport *http.Transport) {
+			transport.Proxy = http.ProxyURL(c.proxy)
+		})
+		if !ok {
+			c.configErr = errors.New("graphql: WithProxy needs an *http.Transport")
+		}
+		c.httpClient = httpClient
+	}
+	if c.insecureTLS && c.configErr == nil {
+		httpClient, ok := withTransport(c.httpClient, func(transport *http.Transport) {
+			if transport.TLSClientConfig == nil {
+				transport.TLSClientConfig = &tls.Config{}
+			} else {
+				transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+			}
+			transport.TLSClientConfig.InsecureSkipVerify = true
+		})
+		if !ok {
+			c.configErr = errors.New("graphql: WithInsecureSkipVerify needs an *http.Transport")
+		}
+		c.httpClient = httpClient
+	}
+	if c.http2 {
+		c.httpClient = forceHTTP2(c.httpClient)
+	}
 	return c
 }
 
-func (c *Client) logf(format string, args ...interface{}) {
-	c.Log(fmt.Sprintf(format, args...))
+// NewClientE makes a new Client like NewClient, but returns an error when
+// the endpoint is not an absolute http or https URL, or when an option is
+// invalid, so that a misconfigured client fails fast. The endpoint can
+// be empty when WithEndpointResolver always resolves one.
+func NewClientE(endpoint string, opts ...ClientOption) (*Client, error) {
+	c := NewClient(endpoint, opts...)
+	if err := c.configErr; err != nil {
+		return nil, err
+	}
+	if endpoint == "" && c.endpointResolver != nil {
+		return c, nil
+	}
+	if err := checkEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkEndpoint checks that endpoint is an absolute http or https URL.
+func checkEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return errors.Wrap(err, "graphql: invalid endpoint")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("graphql: invalid endpoint %q: scheme must be http or https", endpoint)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("graphql: invalid endpoint %q: missing host", endpoint)
+	}
+	return nil
+}
+
+// Err gets the error of an invalid option given to NewClient, such as
+// a malformed WithProxy URL. Running requests with such a client fails
+// with this error.
+func (c *Client) Err() error {
+	return c.configErr
+}
+
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func decodeJSON(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+func (c *Client) logf(ctx context.Context, format string, args ...interface{}) {
+	s := fmt.Sprintf(format, args...)
+	if c.logger != nil {
+		c.logger(ctx, s)
+	}
+	if id := RequestID(ctx); id != "" {
+		s = "[" + id + "] " + s
+	}
+	c.Log(s)
 }
 
 // Run executes the query and unmarshals the response from the data field
 // into the response object.
 // Pass in a nil response object to skip response parsing.
+// A successful response without a body, such as 204 No Content, leaves
+// the response object untouched.
 func (c *Client) Run(ctx context.Context, req *Request, resp interface{}) error {
+	return c.run(ctx, req, &graphResponse{Data: resp})
+}
+
+// RunWithMeta executes the query like Run and additionally returns
+// the status code and headers of the HTTP response.
+// The ResponseMeta is returned whenever a response was received, including
+// when the server reported GraphQL errors.
+func (c *Client) RunWithMeta(ctx context.Context, req *Request, resp interface{}) (*ResponseMeta, error) {
+	gr := &graphResponse{Data: resp}
+	err := c.run(ctx, req, gr)
+	return gr.meta, err
+}
+
+// RunWithExtensions executes the query like Run and additionally returns
+// the top-level extensions object of the response, such as tracing or
+// cost information.
+func (c *Client) RunWithExtensions(ctx context.Context, req *Request, resp interface{}) (map[string]interface{}, error) {
+	gr := &graphResponse{Data: resp}
+	err := c.run(ctx, req, gr)
+	return gr.Extensions, err
+}
+
+// RunRaw executes the query and returns the response body exactly as
+// the server sent it, including data, errors and extensions, without
+// decoding it into a response object.
+// GraphQL errors are still returned as Errors alongside the body.
+func (c *Client) RunRaw(ctx context.Context, req *Request) (json.RawMessage, error) {
+	gr := &graphResponse{}
+	err := c.run(ctx, req, gr)
+	return gr.raw, err
+}
+
+// RunRawData executes the query and returns the data field of the
+// response undecoded, so it can be decoded later, such as once a field
+// of the data tells its shape. GraphQL errors reported with a successful
+// response are returned as errs rather than err.
+func (c *Client) RunRawData(ctx context.Context, req *Request) (data json.RawMessage, errs Errors, err error) {
+	err = c.run(ctx, req, &graphResponse{Data: &data})
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		errs, err = partial.Errors, nil
+	} else if e, ok := err.(Errors); ok {
+		errs, err = e, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(data) == "null" {
+		data = nil
+	}
+	return data, errs, nil
+}
+
+// defaultPingTimeout bounds the time Ping waits for the server.
+const defaultPingTimeout = 5 * time.Second
+
+// Ping checks that the server answers GraphQL queries, by sending the
+// query "{ __typename }", which every server can execute. It returns nil
+// when the query succeeded. The query is always sent, never answered
+// from the response cache or the ETags of the client. Ping gives up
+// after 5 seconds, or earlier when ctx is done, which suits readiness
+// probes.
+func (c *Client) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultPingTimeout)
+	defer cancel()
+	var resp struct {
+		Typename string `json:"__typename"`
+	}
+	req := NewRequest("{ __typename }")
+	req.noCache = true
+	req.Header.Set("Cache-Control", "no-cache")
+	if err := c.Run(ctx, req, &resp); err != nil {
+		return err
+	}
+	if resp.Typename == "" {
+		return errors.New("graphql: ping response has no __typename")
+	}
+	return nil
+}
+
+// RunInto executes the query like Run but only unmarshals the node of
+// the data field found at path into the response object. The path is a
+// dotted list of field names and list indexes, such as
+// "viewer.repositories.nodes.0".
+// An error is returned when the path doesn't exist in the response.
+func (c *Client) RunInto(ctx context.Context, req *Request, path string, resp interface{}) error {
+	var data json.RawMessage
+	err := c.run(ctx, req, &graphResponse{Data: &data})
+	var partial *PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return err
+	}
+	node, pathErr := dataAt(data, path)
+	if pathErr != nil {
+		if err != nil {
+			return err
+		}
+		return pathErr
+	}
+	if resp != nil {
+		if err := c.decodeJSON(bytes.NewReader(node), resp); err != nil {
+			return &DecodeError{Body: node, Err: err}
+		}
+	}
+	return err
+}
+
+// RunMulti executes the query like Run and unmarshals each top-level
+// field of the data named by a key of targets into the response object
+// of that key, so each field can be decoded into its own type:
+//  var user User
+//  var settings Settings
+//  err := client.RunMulti(ctx, req, map[string]interface{}{
+//      "user":     &user,
+//      "settings": &settings,
+//  })
+// An error is returned when a field is missing from the response.
+func (c *Client) RunMulti(ctx context.Context, req *Request, targets map[string]interface{}) error {
+	var data map[string]json.RawMessage
+	err := c.run(ctx, req, &graphResponse{Data: &data})
+	var partial *PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return err
+	}
+	for field, target := range targets {
+		node, ok := data[field]
+		if !ok {
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("graphql: field %q not found in response data", field)
+		}
+		if target == nil {
+			continue
+		}
+		if err := c.decodeJSON(bytes.NewReader(node), target); err != nil {
+			return &DecodeError{Body: node, Err: err}
+		}
+	}
+	return err
+}
+
+// dataAt finds the node at the dotted path in data.
+func dataAt(data json.RawMessage, path string) (json.RawMessage, error) {
+	node := data
+	for _, segment := range strings.Split(path, ".") {
+		if segment == "" {
+			continue
+		}
+		var found bool
+		if index, err := strconv.Atoi(segment); err == nil {
+			var list []json.RawMessage
+			if json.Unmarshal(node, &list) == nil && index >= 0 && index < len(list) {
+				node, found = list[index], true
+			}
+		} else {
+			var object map[string]json.RawMessage
+			if json.Unmarshal(node, &object) == nil {
+				node, found = object[segment]
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("graphql: path %q not found in response data", path)
+		}
+	}
+	return node, nil
+}
+
+// Prepare builds the HTTP request that Run would send for req, with its
+// headers and encoded body, without sending it. This is useful to inspect
+// or snapshot the exact bytes of a request.
+// The request is built with the full query, even when persisted queries
+// are enabled, and the readers of its files are consumed.
+func (c *Client) Prepare(ctx context.Context, req *Request) (*http.Request, error) {
+	ctx = withRequestID(ctx)
+	defer req.closeFiles()
+	if len(req.files) > 0 && c.fileUploadMode == FileUploadNone {
+		return nil, errors.New("cannot send files with PostFields option")
+	}
+	if err := req.checkFiles(); err != nil {
+		return nil, err
+	}
+	if err := c.configErr; err != nil {
+		return nil, err
+	}
+	req = req.runCopy()
+	defer req.removeReplay()
+	if err := c.resolveDocument(req); err != nil {
+		return nil, err
+	}
+	if err := c.rewriteRequest(req); err != nil {
+		return nil, err
+	}
+	if err := c.encode(ctx, req); err != nil {
+		return nil, err
+	}
+	if err := req.bufferBody(ctx); err != nil {
+		return nil, err
+	}
+	header, err := c.requestHeader(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.newHTTPRequest(ctx, req, header, bytes.NewReader(req.body.Bytes()))
+}
+
+func (c *Client) run(ctx context.Context, req *Request, gr *graphResponse) (err error) {
+	ctx = withRequestID(ctx)
+	defer req.closeFiles()
+	if _, ok := c.metrics.(nopMetrics); !ok || c.stats != nil || c.events != nil {
+		start := time.Now()
+		defer func() {
+			dur := time.Since(start)
+			c.metrics.ObserveRequest(metricsOperation(req), dur, err)
+			c.stats.observe(dur, err)
+			c.sendEvent(req, gr, start, dur, err)
+		}()
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	if len(c.middleware) == 0 {
+		return contextError(ctx, c.execute(ctx, req, gr))
+	}
+	return contextError(ctx, c.chain(gr)(ctx, req, gr.Data))
+}
+
+// execute runs the request without middleware.
+func (c *Client) execute(ctx context.Context, req *Request, gr *graphResponse) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
 	}
-	if len(req.files) > 0 && !(c.useMultipartForm || c.useMultipartRequestSpec) {
+	if len(req.files) > 0 && c.fileUploadMode == FileUploadNone {
 		return errors.New("cannot send files with PostFields option")
 	}
-	if c.useMultipartForm {
-		return c.runWithPostFields(ctx, req, resp)
+	if err := req.checkFiles(); err != nil {
+		return err
+	}
+	if err := c.configErr; err != nil {
+		return err
+	}
+	if err := c.schemaVersion.err(); err != nil {
+		return err
+	}
+	// the state of the run is kept on a copy, so the request can be run
+	// concurrently
+	req = req.runCopy()
+	defer req.removeReplay()
+	if err := c.resolveDocument(req); err != nil {
+		return err
+	}
+	if err := c.rewriteRequest(req); err != nil {
+		return err
+	}
+	if c.localVariableCheck {
+		var fileVariables map[string]bool
+		if c.fileUploadMode == FileUploadSpec && len(req.files) > 0 {
+			fileVariables = req.fileVariables()
+		}
+		if err := req.checkVariables(fileVariables); err != nil {
+			return err
+		}
+	}
+	if c.persistedQueries && req.documentID == "" && len(req.files) == 0 && c.fileUploadMode != FileUploadForm && !c.useGraphQLContentType {
+		return c.runPersistedQuery(ctx, req, gr)
+	}
+	return c.dispatch(ctx, req, gr)
+}
+
+// rewriteRequest replaces the query of the run copy of a request with
+// the result of the query transform of the client, and adds the base
+// variables of the client to its variables.
+func (c *Client) rewriteRequest(req *Request) error {
+	if req.rawVars != nil {
+		if len(req.vars) > 0 {
+			return errors.New("graphql: request has both raw variables and variables set with Var")
+		}
+		if _, err := req.rawVariableMap(); err != nil {
+			return err
+		}
+	}
+	if c.queryTransform != nil {
+		transformed, err := c.queryTransform(req.q)
+		if err != nil {
+			return errors.Wrap(err, "query transform")
+		}
+		req.q = transformed
+	}
+	if len(c.baseVariables) > 0 {
+		merged := make(map[string]interface{}, len(c.baseVariables)+len(req.vars))
+		for key, value := range c.baseVariables {
+			merged[key] = value
+		}
+		for key, value := range req.variableMap() {
+			merged[key] = value
+		}
+		req.vars, req.rawVars = merged, nil
+	}
+	return nil
+}
+
+// dispatch encodes and sends the request in the format configured
+// for the client.
+func (c *Client) dispatch(ctx context.Context, req *Request, gr *graphResponse) error {
+	if err := c.encode(ctx, req); err != nil {
+		return err
+	}
+	return c.makeRequest(ctx, req, gr)
+}
+
+// encode encodes the request in the format configured for the client.
+func (c *Client) encode(ctx context.Context, req *Request) error {
+	endpoint, err := c.resolveEndpoint(ctx, req)
+	if err != nil {
+		return err
+	}
+	req.endpoint = endpoint
+	req.writeBody = nil
+	method := c.operationMethod(req)
+	if len(req.files) == 0 && (method == http.MethodGet || c.useGETForQueries && req.operationType() == "query") {
+		return c.encodeGET(ctx, req)
+	}
+	if err := c.encodeBody(ctx, req); err != nil {
+		return err
+	}
+	if method != "" && method != http.MethodGet {
+		req.method = method
+	}
+	return nil
+}
+
+// operationMethod gets the HTTP method set with WithMethods for the type
+// of the operation of the request, or an empty string.
+func (c *Client) operationMethod(req *Request) string {
+	switch req.operationType() {
+	case "query":
+		return c.queryMethod
+	case "mutation":
+		return c.mutationMethod
+	}
+	return ""
+}
+
+func (c *Client) encodeBody(ctx context.Context, req *Request) error {
+	if c.fileUploadMode == FileUploadForm {
+		return c.encodePostFields(ctx, req)
+	}
+	if c.fileUploadMode == FileUploadSpec && len(req.files) > 0 {
+		return c.encodeMultipartRequestSpec(ctx, req)
+	}
+	if c.useGraphQLContentType {
+		return c.encodeGraphQL(ctx, req)
 	}
-	if c.useMultipartRequestSpec && len(req.Files()) > 0 {
-		return c.runMultipartRequestSpec(ctx, req, resp)
+	return c.encodeJSONBody(ctx, req)
+}
+
+// resolveEndpoint gets the endpoint the request is sent to.
+func (c *Client) resolveEndpoint(ctx context.Context, req *Request) (string, error) {
+	if c.endpointResolver == nil {
+		return c.endpoint, nil
+	}
+	endpoint, err := c.endpointResolver(ctx, req)
+	if err != nil {
+		return "", errors.Wrap(err, "endpoint resolver")
+	}
+	if endpoint == "" {
+		return c.endpoint, nil
+	}
+	return endpoint, nil
+}
+
+func (c *Client) encodeGraphQL(ctx context.Context, req *Request) error {
+	if req.hasVariables() {
+		return errors.New("cannot send variables with the application/graphql content type")
 	}
-	return c.runWithJSON(ctx, req, resp)
+	c.logf(ctx, ">> query: %s", req.q)
+
+	req.method = http.MethodPost
+	req.url = req.endpoint
+	req.body = bytes.Buffer{}
+	req.body.WriteString(req.q)
+	req.contentType = "application/graphql; charset=utf-8"
+	req.contentEncoding = ""
+	return nil
 }
 
-func (c *Client) runWithJSON(ctx context.Context, req *Request, resp interface{}) error {
+func (c *Client) encodeJSONBody(ctx context.Context, req *Request) error {
 	var requestBody bytes.Buffer
 	requestBodyObj := struct {
-		Query     string                 `json:"query"`
-		Variables map[string]interface{} `json:"variables"`
+		Query         *string                `json:"query,omitempty"`
+		DocumentID    string                 `json:"documentId,omitempty"`
+		Variables     interface{}            `json:"variables"`
+		OperationName string                 `json:"operationName,omitempty"`
+		Extensions    map[string]interface{} `json:"extensions,omitempty"`
 	}{
-		Query:     req.q,
-		Variables: req.vars,
+		DocumentID:    req.documentID,
+		Variables:     req.variables(),
+		OperationName: req.OpName,
+		Extensions:    req.extensions,
+	}
+	if !req.omitQuery && req.documentID == "" {
+		requestBodyObj.Query = &req.q
 	}
-	if err := json.NewEncoder(&requestBody).Encode(requestBodyObj); err != nil {
+	if err := c.encodeJSON(&requestBody, requestBodyObj); err != nil {
 		return errors.Wrap(err, "encode body")
 	}
-	c.logf(">> variables: %v", req.vars)
-	c.logf(">> query: %s", req.q)
-	gr := &graphResponse{
-		Data: resp,
+	c.logf(ctx, ">> variables: %v", c.redactVariables(req.variableMap()))
+	c.logf(ctx, ">> query: %s", req.q)
+
+	req.contentEncoding = ""
+	if c.compressRequests && requestBody.Len() >= c.compressMinBytes {
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		if _, err := requestBody.WriteTo(zw); err != nil {
+			return errors.Wrap(err, "compress body")
+		}
+		if err := zw.Close(); err != nil {
+			return errors.Wrap(err, "compress body")
+		}
+		requestBody = compressed
+		req.contentEncoding = "gzip"
+	}
+
+	req.method = http.MethodPost
+	req.url = req.endpoint
+	req.body = requestBody
+	req.contentType = "application/json; charset=utf-8"
+	return nil
+}
+
+func (c *Client) encodeGET(ctx context.Context, req *Request) error {
+	u, err := url.Parse(req.endpoint)
+	if err != nil {
+		return errors.Wrap(err, "parse endpoint")
+	}
+	params := u.Query()
+	switch {
+	case req.documentID != "":
+		params.Set("documentId", req.documentID)
+	case !req.omitQuery:
+		params.Set("query", req.q)
+	}
+	if req.hasVariables() {
+		variables, err := json.Marshal(req.variables())
+		if err != nil {
+			return errors.Wrap(err, "encode variables")
+		}
+		params.Set("variables", string(variables))
+	}
+	if req.OpName != "" {
+		params.Set("operationName", req.OpName)
+	}
+	if len(req.extensions) > 0 {
+		extensions, err := json.Marshal(req.extensions)
+		if err != nil {
+			return errors.Wrap(err, "encode extensions")
+		}
+		params.Set("extensions", string(extensions))
+	}
+	u.RawQuery = params.Encode()
+	if c.getMaxURLLength > 0 && len(u.String()) > c.getMaxURLLength {
+		c.logf(ctx, ">> url exceeds %d bytes, falling back to POST", c.getMaxURLLength)
+		return c.encodeJSONBody(ctx, req)
+	}
+	c.logf(ctx, ">> variables: %v", c.redactVariables(req.variableMap()))
+	c.logf(ctx, ">> query: %s", req.q)
+
+	req.method = http.MethodGet
+	req.url = u.String()
+	req.body = bytes.Buffer{}
+	req.contentType = ""
+	req.contentEncoding = ""
+	return nil
+}
+
+func (c *Client) encodePostFields(ctx context.Context, req *Request) error {
+	query, opName, documentID := req.q, req.OpName, req.documentID
+	var variables bytes.Buffer
+	if req.hasVariables() {
+		if err := c.encodeJSON(&variables, req.variables()); err != nil {
+			return errors.Wrap(err, "encode variables")
+		}
+	}
+	c.logf(ctx, ">> variables: %v", c.redactVariables(req.variableMap()))
+	c.logf(ctx, ">> files: %d", len(req.files))
+	c.logf(ctx, ">> query: %s", query)
+
+	req.method = http.MethodPost
+	req.url = req.endpoint
+	req.contentEncoding = ""
+	return req.setMultipartBody(ctx, c.multipartBoundary, func(writer *multipart.Writer, writeFile func(dst io.Writer, i int) error) error {
+		if documentID != "" {
+			if err := writer.WriteField("documentId", documentID); err != nil {
+				return errors.Wrap(err, "write documentId field")
+			}
+		} else if err := writer.WriteField("query", query); err != nil {
+			return errors.Wrap(err, "write query field")
+		}
+		if opName != "" {
+			if err := writer.WriteField("operationName", opName); err != nil {
+				return errors.Wrap(err, "write operationName field")
+			}
+		}
+		if variables.Len() > 0 {
+			variablesField, err := writer.CreateFormField("variables")
+			if err != nil {
+				return errors.Wrap(err, "create variables field")
+			}
+			if _, err := variablesField.Write(variables.Bytes()); err != nil {
+				return errors.Wrap(err, "write variables field")
+			}
+		}
+		for i, file := range req.files {
+			part, err := createFormFile(writer, file)
+			if err != nil {
+				return errors.Wrap(err, "create form file")
+			}
+			if err := writeFile(part, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *Client) encodeMultipartRequestSpec(ctx context.Context, req *Request) error {
+	// the map refers to the parts of the files by their field
+	fields := make(map[string]bool, len(req.files))
+	for _, file := range req.files {
+		if fields[file.Field] {
+			return errors.Errorf("graphql: several files have the field %q", file.Field)
+		}
+		fields[file.Field] = true
+	}
+	multipartRequestSpecQuery := req.fillMultipartRequestSpecQuery()
+	operations, err := json.Marshal(multipartRequestSpecQuery.Operations)
+	if err != nil {
+		return errors.Wrap(err, "marshal operations")
 	}
-	r, err := http.NewRequest(http.MethodPost, c.endpoint, &requestBody)
+	maps, err := json.Marshal(multipartRequestSpecQuery.Map)
+	if err != nil {
+		return errors.Wrap(err, "marshal map")
+	}
+	logged := multipartRequestSpecQuery.Operations
+	if variables, ok := logged.Variables.(map[string]interface{}); ok {
+		logged.Variables = c.redactVariables(variables)
+	}
+	loggedOperations, _ := json.Marshal(logged)
+	operationsField, mapField := "operations", "map"
+	if c.multipartOperationsField != "" {
+		operationsField = c.multipartOperationsField
+	}
+	if c.multipartMapField != "" {
+		mapField = c.multipartMapField
+	}
+	c.logf(ctx, ">> field: %s = %s", operationsField, string(loggedOperations))
+	c.logf(ctx, ">> field: %s = %s", mapField, string(maps))
+
+	req.method = http.MethodPost
+	req.url = req.endpoint
+	req.contentEncoding = ""
+	return req.setMultipartBody(ctx, c.multipartBoundary, func(writer *multipart.Writer, writeFile func(dst io.Writer, i int) error) error {
+		if err := writer.WriteField(operationsField, string(operations)); err != nil {
+			return errors.Wrap(err, "write operation field")
+		}
+		if err := writer.WriteField(mapField, string(maps)); err != nil {
+			return errors.Wrap(err, "write maps field")
+		}
+		for i, file := range req.files {
+			part, err := createFormFile(writer, file)
+			if err != nil {
+				return errors.Wrap(err, "create form file")
+			}
+			if err := writeFile(part, i); err != nil {
+				return err
+			}
+			if err := writer.WriteField(file.Field, `@`+file.Name); err != nil {
+				return errors.Wrap(err, "write maps field")
+			}
+		}
+		return nil
+	})
+}
+
+// copyFile copies a file into the multipart body like io.Copy, stopping
+// once ctx is done.
+func copyFile(ctx context.Context, dst io.Writer, src io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// createFormFile creates a form file part for the file, like
+// multipart.Writer.CreateFormFile but honouring the file's ContentType.
+func createFormFile(writer *multipart.Writer, file File) (io.Writer, error) {
+	if file.ContentType == "" {
+		return writer.CreateFormFile(file.Field, file.Name)
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(file.Field), quoteEscaper.Replace(file.Name)))
+	h.Set("Content-Type", file.ContentType)
+	return writer.CreatePart(h)
+}
+
+func (c *Client) makeRequest(ctx context.Context, req *Request, gr *graphResponse) error {
+	header, err := c.requestHeader(ctx, req)
 	if err != nil {
 		return err
 	}
-	r.Close = c.closeReq
-	r.Header.Set("Content-Type", "application/json; charset=utf-8")
-	r.Header.Set("Accept", "application/json; charset=utf-8")
+	cacheKey, cacheable := c.cacheKey(req, header)
+	if cacheable {
+		if ok, err := c.cachedResponse(ctx, cacheKey, gr); ok {
+			return err
+		}
+	}
+	etagKey, conditional := c.etagKey(req, header)
+	var etag *cacheEntry
+	var hasETag bool
+	if conditional {
+		if etag, hasETag = c.etags.get(etagKey); hasETag {
+			header.Set("If-None-Match", etag.etag)
+		}
+	}
+	res, body, failedAttempt, err := c.sendShared(ctx, req, header)
+	if err != nil {
+		return retryError(failedAttempt, err)
+	}
+	gr.meta = &ResponseMeta{
+		StatusCode: res.StatusCode,
+		Proto:      res.Proto,
+		Header:     res.Header,
+		FromCache:  req.method == http.MethodGet && fromCache(res.Header),
+	}
+	c.schemaVersion.observe(res.Header)
+	if hasETag && res.StatusCode == http.StatusNotModified {
+		c.logf(ctx, "<< not modified, using the response of ETag %s", etag.etag)
+		gr.meta.FromCache = true
+		res = &http.Response{StatusCode: http.StatusOK, Proto: res.Proto, Header: res.Header}
+		body = etag.body
+	}
+	gr.raw = body
+	c.logf(ctx, "<< %s", string(body))
+	if err := c.validate(res, body); err != nil {
+		return err
+	}
+	err = c.decode(res, body, gr)
+	gr.meta.Cost, gr.meta.HasCost = responseCost(res.Header, gr.Extensions)
+	if err != nil {
+		return retryError(failedAttempt, err)
+	}
+	if conditional {
+		c.storeETag(etagKey, res, body)
+	}
+	if cacheable {
+		c.storeResponse(cacheKey, gr)
+	}
+	return nil
+}
+
+// fromCache reports whether the response headers tell that it was
+// served by an HTTP cache.
+func fromCache(header http.Header) bool {
+	if header.Get("Age") != "" {
+		return true
+	}
+	for _, key := range []string{"X-Cache", "X-Cache-Status", "CF-Cache-Status"} {
+		if strings.HasPrefix(strings.ToUpper(header.Get(key)), "HIT") {
+			return true
+		}
+	}
+	return false
+}
+
+// responseCost gets the query cost reported in the X-GraphQL-Cost header
+// or otherwise in extensions.cost, either as a number or as an object
+// with actualQueryCost or requestedQueryCost.
+func responseCost(header http.Header, extensions map[string]interface{}) (float64, bool) {
+	if v := header.Get("X-GraphQL-Cost"); v != "" {
+		if cost, err := strconv.ParseFloat(v, 64); err == nil {
+			return cost, true
+		}
+	}
+	if object, ok := extensions["cost"].(map[string]interface{}); ok {
+		for _, key := range []string{"actualQueryCost", "requestedQueryCost"} {
+			if cost, ok := costNumber(object[key]); ok {
+				return cost, true
+			}
+		}
+		return 0, false
+	}
+	return costNumber(extensions["cost"])
+}
+
+// costNumber gets a cost decoded from JSON as a float64, or as a
+// json.Number when numbers are kept.
+func costNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// requestHeader builds the HTTP headers sent with the request.
+func (c *Client) requestHeader(ctx context.Context, req *Request) (http.Header, error) {
+	header := make(http.Header)
+	if req.contentType != "" {
+		header.Set("Content-Type", req.contentType)
+	}
+	if req.contentEncoding != "" {
+		header.Set("Content-Encoding", req.contentEncoding)
+	}
+	if c.useGraphQLResponseJSON {
+		header.Set("Accept", graphqlResponseJSON)
+	} else {
+		header.Set("Accept", "application/json; charset=utf-8")
+	}
+	if c.noGzip {
+		header.Set("Accept-Encoding", "identity")
+	} else {
+		header.Set("Accept-Encoding", "gzip")
+	}
+	if c.methodOverride {
+		header.Set("X-HTTP-Method-Override", req.method)
+	}
+	if err := c.addHeaders(ctx, req, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// addHeaders adds the headers set for every request made by the client
+// and the headers of the request to header.
+// Headers already in header, such as the default Accept header, are
+// replaced rather than added to.
+func (c *Client) addHeaders(ctx context.Context, req *Request, header http.Header) error {
+	// clientKeys are headers set for every request, which request
+	// headers of the same name replace instead of adding to
+	clientKeys := make(map[string]bool)
+	for key := range header {
+		clientKeys[key] = true
+	}
+	for key, values := range c.header {
+		header.Del(key)
+		for _, value := range values {
+			header.Add(key, value)
+		}
+		clientKeys[key] = true
+	}
+	if c.tokenProvider != nil {
+		token, err := c.tokenProvider(ctx)
+		if err != nil {
+			return errors.Wrap(err, "token provider")
+		}
+		header.Set("Authorization", "Bearer "+token)
+		clientKeys["Authorization"] = true
+	}
+	if c.headerFromContext != nil {
+		for key, values := range c.headerFromContext(ctx) {
+			header.Del(key)
+			for _, value := range values {
+				header.Add(key, value)
+			}
+			clientKeys[textproto.CanonicalMIMEHeaderKey(key)] = true
+		}
+	}
+	if c.operationNameHeader != "" {
+		if name := req.OperationName(); name != "" {
+			header.Set(c.operationNameHeader, name)
+			clientKeys[textproto.CanonicalMIMEHeaderKey(c.operationNameHeader)] = true
+		}
+	}
 	for key, values := range req.Header {
+		if clientKeys[key] {
+			header.Del(key)
+		}
 		for _, value := range values {
-			r.Header.Add(key, value)
+			header.Add(key, value)
 		}
 	}
-	c.logf(">> headers: %v", r.Header)
+	return nil
+}
+
+// newHTTPRequest makes the HTTP request carrying the encoded request.
+func (c *Client) newHTTPRequest(ctx context.Context, req *Request, header http.Header, reqBody io.Reader) (*http.Request, error) {
+	r, err := http.NewRequest(req.method, req.url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if req.writeBody != nil {
+		r.ContentLength = req.contentLength
+	}
+	r.Close = c.closeReq
+	r.Header = header.Clone()
 	r = r.WithContext(ctx)
+	if c.requestMutator != nil {
+		if err := c.requestMutator(r); err != nil {
+			return nil, errors.Wrap(err, "request mutator")
+		}
+	}
+	return r, nil
+}
+
+// roundTrip sends the encoded request once and reads the whole response body.
+func (c *Client) roundTrip(ctx context.Context, req *Request, header http.Header, reqBody []byte) (*http.Response, []byte, error) {
+	var bodyReader io.Reader = bytes.NewReader(reqBody)
+	size := len(reqBody)
+	var u *upload
+	if req.writeBody != nil {
+		u = req.startUpload(ctx)
+		bodyReader = u.r
+		size = int(req.contentLength)
+	}
+	r, err := c.newHTTPRequest(ctx, req, header, bodyReader)
+	if err != nil {
+		if u != nil {
+			u.wait()
+		}
+		return nil, nil, err
+	}
+	c.logf(ctx, ">> headers: %v", c.redactHeader(r.Header))
+	c.logEntry(LogEntry{Phase: LogPhaseRequest, Method: req.method, URL: req.url, Bytes: size})
+	r.Body = withProgress(r.Body, r.ContentLength, c.uploadProgress)
+	start := time.Now()
+	res, body, err := c.do(r)
+	if u != nil {
+		// a failure to write the body, such as reading a file, explains
+		// why sending failed better than the transport does
+		if uploadErr := u.wait(); uploadErr != nil {
+			res, body, err = nil, nil, uploadErr
+		}
+	}
+	elapsed := time.Since(start)
+	entry := LogEntry{Phase: LogPhaseResponse, Method: req.method, URL: req.url, Bytes: len(body), Duration: elapsed, Err: err}
+	if res != nil {
+		entry.StatusCode = res.StatusCode
+	}
+	c.logEntry(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.logf(ctx, "<< %d %d bytes in %s", res.StatusCode, len(body), elapsed)
+	return res, body, nil
+}
+
+// maxDrainBytes is how much of the rest of a response body is read
+// before closing it, so the connection can be reused, without reading
+// the rest of a body that is too large or endless.
+const maxDrainBytes = 64 << 10
+
+// do sends the HTTP request and reads the whole response body.
+func (c *Client) do(r *http.Request) (*http.Response, []byte, error) {
 	res, err := c.httpClient.Do(r)
 	if err != nil {
-		return err
+		return nil, nil, &NetworkError{Err: err}
+	}
+	res.Body = withProgress(res.Body, res.ContentLength, c.downloadProgress)
+	// the body is drained on every path so the connection can be
+	// reused by the transport
+	defer func() {
+		io.CopyN(ioutil.Discard, res.Body, maxDrainBytes)
+		res.Body.Close()
+	}()
+	var body io.Reader = res.Body
+	// the Accept-Encoding header is set explicitly, so the transport
+	// leaves decompression to us
+	if err := c.checkEncoding(res); err != nil {
+		return res, nil, err
+	}
+	if strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(res.Body)
+		switch {
+		case err == io.EOF:
+			body = bytes.NewReader(nil)
+		case err != nil:
+			return res, nil, &NetworkError{Err: errors.Wrap(err, "decompress body")}
+		default:
+			defer zr.Close()
+			body = zr
+		}
+	}
+	if c.maxResponseBytes > 0 {
+		body = io.LimitReader(body, c.maxResponseBytes+1)
 	}
-	defer res.Body.Close()
 	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, res.Body); err != nil {
-		return errors.Wrap(err, "reading body")
+	if _, err := io.Copy(&buf, body); err != nil {
+		return res, nil, &NetworkError{Err: errors.Wrap(err, "reading body")}
+	}
+	if c.maxResponseBytes > 0 && int64(buf.Len()) > c.maxResponseBytes {
+		return res, nil, &ResponseTooLargeError{Limit: c.maxResponseBytes}
+	}
+	return res, buf.Bytes(), nil
+}
+
+// validate runs the response validator of the client, giving it
+// a readable copy of the body.
+func (c *Client) validate(res *http.Response, body []byte) error {
+	if c.validateResponse == nil {
+		return nil
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return c.validateResponse(res)
+}
+
+func (c *Client) decode(res *http.Response, body []byte, gr *graphResponse) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 && len(bytes.TrimSpace(body)) == 0 {
+		// a successful response without data, such as 204 No Content
+		return nil
 	}
-	c.logf("<< %s", buf.String())
-	if err := json.NewDecoder(&buf).Decode(&gr); err != nil {
+	result := c.standardKeys(body)
+	if err := c.decodeJSON(bytes.NewReader(result), &gr); err != nil {
 		if res.StatusCode != http.StatusOK {
-			return fmt.Errorf("graphql: server returned a non-200 status code: %v", res.StatusCode)
+			return &StatusError{StatusCode: res.StatusCode, Body: body}
 		}
-		return errors.Wrap(err, "decoding response")
+		return &DecodeError{Body: body, Err: err}
+	}
+	setRawErrors(result, gr.Errors)
+	if c.isRequestError(res) {
+		return &RequestError{StatusCode: res.StatusCode, Errors: gr.Errors}
 	}
 	if len(gr.Errors) > 0 {
+		if res.StatusCode != http.StatusOK {
+			return &StatusError{StatusCode: res.StatusCode, Body: body, Errors: gr.Errors}
+		}
+		if c.partialData {
+			if data := responseData(result); data != nil {
+				return &PartialError{Errors: gr.Errors, Data: data}
+			}
+		}
 		return gr.Errors
 	}
 	return nil
 }
 
-func (c *Client) runWithPostFields(ctx context.Context, req *Request, resp interface{}) error {
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-	if err := writer.WriteField("query", req.q); err != nil {
-		return errors.Wrap(err, "write query field")
+// standardKeys unwraps the result from the envelope set with
+// WithResponseEnvelope, and renames the keys set with WithDataKey and
+// WithErrorsKey in the result to data and errors.
+func (c *Client) standardKeys(result []byte) []byte {
+	if c.responseEnvelope != "" {
+		if node, err := dataAt(result, c.responseEnvelope); err == nil {
+			result = node
+		}
 	}
-	var variablesBuf bytes.Buffer
-	if len(req.vars) > 0 {
-		variablesField, err := writer.CreateFormField("variables")
-		if err != nil {
-			return errors.Wrap(err, "create variables field")
+	if c.dataKey == "" && c.errorsKey == "" {
+		return result
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil {
+		// decoding reports the error
+		return result
+	}
+	for standard, key := range map[string]string{"data": c.dataKey, "errors": c.errorsKey} {
+		if key == "" || key == standard {
+			continue
 		}
-		if err := json.NewEncoder(io.MultiWriter(variablesField, &variablesBuf)).Encode(req.vars); err != nil {
-			return errors.Wrap(err, "encode variables")
+		value, ok := fields[key]
+		delete(fields, standard)
+		delete(fields, key)
+		if ok {
+			fields[standard] = value
+		}
+	}
+	renamed, err := json.Marshal(fields)
+	if err != nil {
+		return result
+	}
+	return renamed
+}
+
+// graphqlResponseJSON is the media type of GraphQL responses defined
+// by the GraphQL over HTTP specification.
+const graphqlResponseJSON = "application/graphql-response+json"
+
+// isRequestError reports whether the server rejected the request itself,
+// following the GraphQL over HTTP specification.
+func (c *Client) isRequestError(res *http.Response) bool {
+	if !c.useGraphQLResponseJSON || res.StatusCode < 400 || res.StatusCode >= 500 {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return mediaType == graphqlResponseJSON
+}
+
+// setRawErrors sets Raw of each of errs to the error object at the same
+// index in the errors field of the response body.
+func setRawErrors(body []byte, errs Errors) {
+	if len(errs) == 0 {
+		return
+	}
+	var response struct {
+		Errors []json.RawMessage
+	}
+	if err := json.Unmarshal(body, &response); err != nil || len(response.Errors) != len(errs) {
+		return
+	}
+	for i := range errs {
+		errs[i].Raw = response.Errors[i]
+	}
+}
+
+// responseData gets the data field of the response body, or nil when
+// it is missing or null.
+func responseData(body []byte) json.RawMessage {
+	var response struct {
+		Data json.RawMessage
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil
+	}
+	if len(response.Data) == 0 || string(response.Data) == "null" {
+		return nil
+	}
+	return response.Data
+}
+
+type multipartRequestSpecQuery struct {
+	Operations struct {
+		Query         *string     `json:"query,omitempty"`
+		DocumentID    string      `json:"documentId,omitempty"`
+		Variables     interface{} `json:"variables"`
+		OperationName string      `json:"operationName,omitempty"`
+	} `json:"operations"`
+	Map map[string][]string `json:"map"`
+}
+
+func (req *Request) fillMultipartRequestSpecQuery() multipartRequestSpecQuery {
+	query := new(multipartRequestSpecQuery)
+	if req.documentID != "" {
+		query.Operations.DocumentID = req.documentID
+	} else {
+		q := req.Query()
+		query.Operations.Query = &q
+	}
+	query.Operations.OperationName = req.OpName
+	query.Map = make(map[string][]string)
+
+	// file placeholders are merged into the request variables, they
+	// must be null in operations and are referenced from the map
+	vars := req.variableMap()
+	variables := make(map[string]interface{}, len(vars)+1)
+	for key, value := range vars {
+		variables[key] = value
+	}
+	// files added with FileList are indexed within their own variable,
+	// files whose field is a variable of the operation are mapped to it,
+	// and the others are mapped to file or files
+	declared := make(map[string]bool)
+	if op, ok := req.operation(); ok {
+		for _, v := range parseVariables(op.variables) {
+			declared[v.name] = true
+		}
+	}
+	var single []File
+	lists := make(map[string]int)
+	for _, file := range req.Files() {
+		if file.list == "" && declared[file.Field] {
+			variables[file.Field] = nil
+			query.Map[file.Field] = []string{`variables.` + file.Field}
+			continue
+		}
+		if file.list == "" {
+			single = append(single, file)
+			continue
+		}
+		query.Map[file.Field] = []string{`variables.` + file.list + `.` + strconv.Itoa(lists[file.list])}
+		lists[file.list]++
+	}
+	for list, c := range lists {
+		variables[list] = make([]interface{}, c)
+	}
+	switch c := len(single); {
+	case c == 1:
+		variables["file"] = nil
+		query.Map[single[0].Field] = []string{`variables.file`}
+	case c > 1:
+		files := make([]interface{}, c)
+		for index, file := range single {
+			query.Map[file.Field] = []string{`variables.files.` + strconv.Itoa(index)}
+		}
+		variables["files"] = files
+	}
+	query.Operations.Variables = variables
+	return *query
+}
+
+// fileVariables gets the names of the variables that the files of the
+// request are mapped to in a multipart request.
+func (req *Request) fileVariables() map[string]bool {
+	vars := make(map[string]bool)
+	for _, paths := range req.fillMultipartRequestSpecQuery().Map {
+		for _, path := range paths {
+			name := strings.TrimPrefix(path, "variables.")
+			if i := strings.IndexByte(name, '.'); i >= 0 {
+				name = name[:i]
+			}
+			vars[name] = true
 		}
 	}
-	for i := range req.files {
-		part, err := writer.CreateFormFile(req.files[i].Field, req.files[i].Name)
+	return vars
+}
+
+// WithHTTPClient specifies the underlying http.Client to use when
+// making requests.
+//  NewClient(endpoint, WithHTTPClient(specificHTTPClient))
+func WithHTTPClient(httpclient *http.Client) ClientOption {
+	return func(client *Client) {
+		client.httpClient = httpclient
+	}
+}
+
+// WithEndpointResolver calls fn before each request to get the endpoint
+// to send it to, for example depending on the tenant carried by the
+// context. When fn returns an empty string, the endpoint given to
+// NewClient is used. For batches, req holds the headers of the batch.
+func WithEndpointResolver(fn func(ctx context.Context, req *Request) (string, error)) ClientOption {
+	return func(client *Client) {
+		client.endpointResolver = fn
+	}
+}
+
+// WithHTTP2 makes the client attempt HTTP/2 over TLS even when its
+// transport has a custom TLS configuration or dialer, which otherwise
+// disables HTTP/2. It applies to an *http.Transport, which is copied
+// rather than changed. ResponseMeta.Proto tells the negotiated protocol.
+func WithHTTP2() ClientOption {
+	return func(client *Client) {
+		client.http2 = true
+	}
+}
+
+// forceHTTP2 gets a copy of httpClient attempting HTTP/2.
+func forceHTTP2(httpClient *http.Client) *http.Client {
+	httpClient, _ = withTransport(httpClient, func(transport *http.Transport) {
+		transport.ForceAttemptHTTP2 = true
+	})
+	return httpClient
+}
+
+// withTransport gets a copy of httpClient whose *http.Transport is
+// changed by fn. It returns httpClient and false when its transport is
+// not an *http.Transport.
+func withTransport(httpClient *http.Client, fn func(*http.Transport)) (*http.Client, bool) {
+	transport, ok := httpClient.Transport.(*http.Transport)
+	if httpClient.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok {
+		return httpClient, false
+	}
+	transport = transport.Clone()
+	fn(transport)
+	copied := *httpClient
+	copied.Transport = transport
+	return &copied, true
+}
+
+// WithInsecureSkipVerify disables the verification of the TLS
+// certificate of the server, for development against an endpoint with
+// a self-signed certificate.
+//
+// WARNING: this makes the connection open to man-in-the-middle attacks.
+// Never use it in production.
+//
+// It applies to an *http.Transport, which is copied rather than changed.
+func WithInsecureSkipVerify() ClientOption {
+	return func(client *Client) {
+		client.insecureTLS = true
+	}
+}
+
+// WithProxy sends the requests, and the WebSocket connections of
+// Subscribe, through the HTTP, HTTPS or SOCKS5 proxy at proxyURL, such
+// as "http://proxy.example.com:3128", instead of the one set by the
+// HTTP_PROXY and HTTPS_PROXY environment variables. It applies to an
+// *http.Transport, which is copied rather than changed.
+// A malformed URL is reported by Client.Err.
+func WithProxy(proxyURL string) ClientOption {
+	return func(client *Client) {
+		u, err := url.Parse(proxyURL)
 		if err != nil {
-			return errors.Wrap(err, "create form file")
+			client.configErr = errors.Wrap(err, "graphql: invalid proxy URL")
+			return
 		}
-		if _, err := io.Copy(part, req.files[i].R); err != nil {
-			return errors.Wrap(err, "preparing file")
+		switch {
+		case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5":
+			client.configErr = fmt.Errorf("graphql: invalid proxy URL %q: scheme must be http, https or socks5", proxyURL)
+		case u.Host == "":
+			client.configErr = fmt.Errorf("graphql: invalid proxy URL %q: missing host", proxyURL)
+		default:
+			client.proxy = u
 		}
 	}
-	if err := writer.Close(); err != nil {
-		return errors.Wrap(err, "close writer")
+}
+
+// WithCookieJar stores the cookies set by the server in jar and sends
+// them with later requests, such as a session cookie set by a login
+// mutation. The http.Client of the client is copied rather than changed.
+//  jar, _ := cookiejar.New(nil)
+//  NewClient(endpoint, WithCookieJar(jar))
+func WithCookieJar(jar http.CookieJar) ClientOption {
+	return func(client *Client) {
+		client.cookieJar = jar
+	}
+}
+
+// FileUploadMode tells how a client sends requests, and whether it
+// supports files.
+type FileUploadMode int
+
+const (
+	// FileUploadNone sends requests as JSON. Requests carrying files fail.
+	FileUploadNone FileUploadMode = iota
+	// FileUploadForm sends every request as multipart/form-data, with
+	// the query, operationName and variables in form fields of the same
+	// name and each file in the form field named by File.Field.
+	FileUploadForm
+	// FileUploadSpec sends requests carrying files following the GraphQL
+	// multipart request specification, and the others as JSON:
+	// https://github.com/jaydenseric/graphql-multipart-request-spec
+	FileUploadSpec
+)
+
+// WithFileUploadMode sets how the client sends requests carrying files.
+// It replaces the mode set by an earlier option, including
+// UseMultipartForm and UseMultipartRequestSpec: the last one wins.
+// Files are streamed to the server as they are read rather than held in
+// memory, unless the request can be retried.
+func WithFileUploadMode(mode FileUploadMode) ClientOption {
+	return func(client *Client) {
+		client.fileUploadMode = mode
+	}
+}
+
+// WithMultipartFieldNames sets the names of the form fields holding the
+// operations and the map of the files sent with UseMultipartRequestSpec,
+// for servers that don't use the names of the specification.
+func WithMultipartFieldNames(operations, mapField string) ClientOption {
+	return func(client *Client) {
+		client.multipartOperationsField = operations
+		client.multipartMapField = mapField
+	}
+}
+
+// WithMultipartBoundary separates the parts of multipart requests with
+// boundary instead of a random one, so that the bytes of a request are
+// the same every time, as needed to compare them with golden files or to
+// sign them. It is meant for tests: a file containing the boundary
+// would break the request. An invalid boundary is reported by
+// Client.Err.
+func WithMultipartBoundary(boundary string) ClientOption {
+	return func(client *Client) {
+		if err := multipart.NewWriter(nil).SetBoundary(boundary); err != nil {
+			client.configErr = errors.Wrap(err, "graphql: invalid multipart boundary")
+			return
+		}
+		client.multipartBoundary = boundary
 	}
-	c.logf(">> variables: %s", variablesBuf.String())
-	c.logf(">> files: %d", len(req.files))
-	c.logf(">> query: %s", req.q)
+}
+
+// UseMultipartForm uses multipart/form-data and activates support for
+// files. It is WithFileUploadMode(FileUploadForm).
+func UseMultipartForm() ClientOption {
+	return WithFileUploadMode(FileUploadForm)
+}
+
+// UseMultipartRequestSpec uses for files upload, implementing multipart request specification:
+// https://github.com/jaydenseric/graphql-multipart-request-spec
+// Request variables are sent in operations next to the file placeholders.
+// It is WithFileUploadMode(FileUploadSpec).
+func UseMultipartRequestSpec() ClientOption {
+	return WithFileUploadMode(FileUploadSpec)
+}
 
-	req.body = requestBody
-	req.contentType = writer.FormDataContentType()
+// UseGraphQLContentType sends the query as the raw request body with the
+// application/graphql content type, for servers that expect it.
+// Requests with variables fail since they can't be sent that way, and
+// persisted queries are not used.
+func UseGraphQLContentType() ClientOption {
+	return func(client *Client) {
+		client.useGraphQLContentType = true
+	}
+}
 
-	return c.makeRequest(ctx, req, resp)
+// UseGraphQLResponseJSON follows the GraphQL over HTTP specification:
+// responses are requested with the application/graphql-response+json
+// media type, and a 4xx status code with that media type fails with a
+// *RequestError, telling that the request itself is invalid and should
+// not be sent again, while 5xx status codes fail with a *StatusError.
+func UseGraphQLResponseJSON() ClientOption {
+	return func(client *Client) {
+		client.useGraphQLResponseJSON = true
+	}
 }
 
-func (c *Client) runMultipartRequestSpec(ctx context.Context, req *Request, resp interface{}) error {
+// UseGETForQueries sends query operations without files as HTTP GET
+// requests, passing query, variables and operationName as URL query
+// parameters so responses can be cached by HTTP caches.
+// Mutations and requests whose URL would exceed the maximum length
+// (see WithGETMaxURLLength) are still sent with POST.
+func UseGETForQueries() ClientOption {
+	return func(client *Client) {
+		client.useGETForQueries = true
+	}
+}
 
-	if len(req.vars) > 0 {
-		return errors.New("variables doesn't supported due to the multipart request spec https://github.com/jaydenseric/graphql-multipart-request-spec/issues/22")
+// WithMethods sets the HTTP methods queries and mutations are sent with,
+// for servers requiring other methods than POST; an empty method keeps
+// POST. The type of the operation is found from its keyword, and other
+// operations are sent with POST.
+// Operations sent with GET have their query, variables and operationName
+// in the URL like with UseGETForQueries, unless they carry files; the
+// other methods send the same body as POST.
+//  NewClient(endpoint, WithMethods(http.MethodGet, http.MethodPut))
+func WithMethods(query, mutation string) ClientOption {
+	return func(client *Client) {
+		client.queryMethod = query
+		client.mutationMethod = mutation
 	}
+}
 
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
+// defaultGETMaxURLLength is the longest URL UseGETForQueries sends
+// unless changed with WithGETMaxURLLength.
+const defaultGETMaxURLLength = 2048
 
-	multipartRequestSpecQuery := req.fillMultipartRequestSpecQuery()
-	operations, err := json.Marshal(multipartRequestSpecQuery.Operations)
-	if err != nil {
-		return errors.Wrap(err, "marshal operations")
-	}
-	maps, err := json.Marshal(multipartRequestSpecQuery.Map)
-	if err != nil {
-		return errors.Wrap(err, "marshal map")
+// WithGETMaxURLLength sets the maximum URL length of GET requests made
+// with UseGETForQueries; longer requests fall back to POST.
+// A value of zero or less removes the limit.
+func WithGETMaxURLLength(n int) ClientOption {
+	return func(client *Client) {
+		client.getMaxURLLength = n
 	}
+}
 
-	if err := writer.WriteField("operations", string(operations)); err != nil {
-		return errors.Wrap(err, "write operation field")
-	} else {
-		c.logf(">> field: %s = %s", "operations", string(operations))
+// WithRequestCompression gzips JSON request bodies and sets the
+// Content-Encoding: gzip header. Bodies smaller than the threshold set by
+// WithRequestCompressionMinBytes (1024 bytes by default) are sent as is.
+// Multipart requests made with UseMultipartForm or UseMultipartRequestSpec
+// are never compressed.
+func WithRequestCompression() ClientOption {
+	return func(client *Client) {
+		client.compressRequests = true
 	}
+}
 
-	if err := writer.WriteField("map", string(maps)); err != nil {
-		return errors.Wrap(err, "write maps field")
-	} else {
-		c.logf(">> field: %s = %s", "map", string(maps))
+// defaultCompressMinBytes is the smallest body WithRequestCompression
+// compresses unless changed with WithRequestCompressionMinBytes.
+const defaultCompressMinBytes = 1024
+
+// WithRequestCompressionMinBytes sets the smallest request body, in bytes,
+// that WithRequestCompression compresses.
+func WithRequestCompressionMinBytes(n int) ClientOption {
+	return func(client *Client) {
+		client.compressMinBytes = n
 	}
+}
 
-	for i := range req.files {
-		part, err := writer.CreateFormFile(req.files[i].Field, req.files[i].Name)
-		if err != nil {
-			return errors.Wrap(err, "create form file")
+// WithHeader adds a header to every request made by the client.
+// Headers with the same key set on Request.Header replace it.
+//  NewClient(endpoint, WithHeader("X-Tenant", "acme"))
+func WithHeader(key, value string) ClientOption {
+	return func(client *Client) {
+		if client.header == nil {
+			client.header = make(http.Header)
 		}
-		if _, err := io.Copy(part, req.files[i].R); err != nil {
-			return errors.Wrap(err, "preparing file")
+		client.header.Add(key, value)
+	}
+}
+
+// WithBearerToken sets the Authorization header of every request made
+// by the client to the bearer token.
+func WithBearerToken(token string) ClientOption {
+	return func(client *Client) {
+		if client.header == nil {
+			client.header = make(http.Header)
 		}
+		client.header.Set("Authorization", "Bearer "+token)
+	}
+}
 
-		fieldName := req.files[i].Field
-		fieldValue := `@` + req.files[i].Name
+// WithUserAgent sets the User-Agent header of every request made by the
+// client, including batches and subscriptions. A User-Agent set on
+// Request.Header replaces it.
+func WithUserAgent(ua string) ClientOption {
+	return func(client *Client) {
+		if client.header == nil {
+			client.header = make(http.Header)
+		}
+		client.header.Set("User-Agent", ua)
+	}
+}
 
-		if err := writer.WriteField(fieldName, fieldValue); err != nil {
-			return errors.Wrap(err, "write maps field")
-		} else {
-			c.logf(">> field: %s = %s", fieldName, fieldValue)
+// WithClientInfo sets the apollographql-client-name and
+// apollographql-client-version headers of every request made by the
+// client, which Apollo Studio uses to attribute operations to clients.
+func WithClientInfo(name, version string) ClientOption {
+	return func(client *Client) {
+		if client.header == nil {
+			client.header = make(http.Header)
 		}
+		client.header.Set("Apollographql-Client-Name", name)
+		client.header.Set("Apollographql-Client-Version", version)
 	}
-	if err := writer.Close(); err != nil {
-		return errors.Wrap(err, "close writer")
+}
+
+// WithOperationNameHeader sends the name of the operation of each
+// request, as given by Request.OperationName, in the header named
+// headerKey, or X-GraphQL-Operation when headerKey is empty, so the
+// access logs of the server can tell operations apart. Anonymous
+// operations are sent without the header.
+func WithOperationNameHeader(headerKey string) ClientOption {
+	return func(client *Client) {
+		if headerKey == "" {
+			headerKey = "X-GraphQL-Operation"
+		}
+		client.operationNameHeader = headerKey
 	}
+}
 
-	req.body = requestBody
-	req.contentType = writer.FormDataContentType()
+// WithAPIKey sends key in the header named header, or X-API-Key when
+// header is empty, with every request made by the client. It can be
+// used along with WithTokenProvider for services requiring both. The key
+// is redacted from what the client logs.
+//  NewClient(endpoint, WithAPIKey("", os.Getenv("API_KEY")))
+func WithAPIKey(header, key string) ClientOption {
+	return func(client *Client) {
+		if header == "" {
+			header = "X-API-Key"
+		}
+		if client.header == nil {
+			client.header = make(http.Header)
+		}
+		client.apiKeyHeader = http.CanonicalHeaderKey(header)
+		client.header.Set(header, key)
+	}
+}
 
-	return c.makeRequest(ctx, req, resp)
+// WithTokenProvider calls fn before each request to get the bearer token
+// to send in the Authorization header, allowing expiring tokens to be
+// refreshed. When fn returns an error, the request is not sent.
+func WithTokenProvider(fn func(ctx context.Context) (string, error)) ClientOption {
+	return func(client *Client) {
+		client.tokenProvider = fn
+	}
 }
 
-func (c *Client) makeRequest(ctx context.Context, req *Request, resp interface{}) error {
-	gr := &graphResponse{
-		Data: resp,
+// WithHeaderFromContext calls fn with the context of each request to get
+// headers to send with it, such as a request ID carried by the context.
+// They replace headers of the same key set on the client, and are
+// replaced by headers of the same key set on Request.Header.
+func WithHeaderFromContext(fn func(ctx context.Context) http.Header) ClientOption {
+	return func(client *Client) {
+		client.headerFromContext = fn
 	}
-	r, err := http.NewRequest(http.MethodPost, c.endpoint, &req.body)
-	if err != nil {
-		return err
+}
+
+// WithJSONEncoder replaces encoding/json for encoding JSON request
+// bodies and multipart variables.
+func WithJSONEncoder(fn func(w io.Writer, v interface{}) error) ClientOption {
+	return func(client *Client) {
+		client.encodeJSON = fn
 	}
-	r.Close = c.closeReq
-	r.Header.Set("Content-Type", req.contentType)
-	r.Header.Set("Accept", "application/json; charset=utf-8")
-	for key, values := range req.Header {
-		for _, value := range values {
-			r.Header.Add(key, value)
-		}
+}
+
+// WithJSONDecoder replaces encoding/json for decoding responses.
+// To decode numbers as json.Number:
+//  NewClient(endpoint, WithJSONDecoder(func(r io.Reader, v interface{}) error {
+//      d := json.NewDecoder(r)
+//      d.UseNumber()
+//      return d.Decode(v)
+//  }))
+func WithJSONDecoder(fn func(r io.Reader, v interface{}) error) ClientOption {
+	return func(client *Client) {
+		client.decodeJSON = fn
 	}
-	c.logf(">> headers: %v", r.Header)
-	r = r.WithContext(ctx)
-	res, err := c.httpClient.Do(r)
-	if err != nil {
-		return err
+}
+
+// WithResponseValidator calls fn with every HTTP response before it is
+// decoded, for example to reject HTML error pages served by a proxy.
+// The response body can be read by fn. When fn returns an error, Run
+// returns it without decoding the response.
+func WithResponseValidator(fn func(res *http.Response) error) ClientOption {
+	return func(client *Client) {
+		client.validateResponse = fn
 	}
-	defer res.Body.Close()
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, res.Body); err != nil {
-		return errors.Wrap(err, "reading body")
+}
+
+// WithRequestMutator calls fn with every HTTP request once it is fully
+// built, right before it is sent, so it can be changed, for example to
+// sign it. Returning an error aborts the request. fn is called for each
+// retry attempt, and for Prepare, but not for subscriptions.
+// The body of uploads streamed with UseMultipartForm or
+// UseMultipartRequestSpec can't be read by fn.
+func WithRequestMutator(fn func(r *http.Request) error) ClientOption {
+	return func(client *Client) {
+		client.requestMutator = fn
 	}
-	c.logf("<< %s", buf.String())
-	if err := json.NewDecoder(&buf).Decode(&gr); err != nil {
-		if res.StatusCode != http.StatusOK {
-			return fmt.Errorf("graphql: server returned a non-200 status code: %v", res.StatusCode)
+}
+
+// WithBaseVariables sends vars with every request made by the client,
+// such as a tenant ID fixed for a session. Variables of the same name set
+// on the request take precedence.
+func WithBaseVariables(vars map[string]interface{}) ClientOption {
+	return func(client *Client) {
+		if client.baseVariables == nil {
+			client.baseVariables = make(map[string]interface{}, len(vars))
+		}
+		for key, value := range vars {
+			client.baseVariables[key] = value
 		}
-		return errors.Wrap(err, "decoding response")
 	}
-	if len(gr.Errors) > 0 {
-		return gr.Errors
+}
+
+// WithQueryTransform rewrites the query of every request with fn before
+// it is sent, for example to add __typename to selection sets. The query
+// of the Request itself is left unchanged.
+func WithQueryTransform(fn func(q string) (string, error)) ClientOption {
+	return func(client *Client) {
+		client.queryTransform = fn
 	}
-	return nil
 }
 
-type multipartRequestSpecQuery struct {
-	Operations struct {
-		Query     string      `json:"query"`
-		Variables interface{} `json:"variables"`
-	} `json:"operations"`
-	Map map[string][]string `json:"map"`
+// WithLocalVariableCheck makes Run check the variables of each request
+// before sending it: every non-null variable without a default value
+// declared by the operation must have a value, otherwise Run fails
+// without making a round trip to the server.
+func WithLocalVariableCheck() ClientOption {
+	return func(client *Client) {
+		client.localVariableCheck = true
+	}
 }
 
-func (req *Request) fillMultipartRequestSpecQuery() multipartRequestSpecQuery {
-	type fileVariables struct {
-		File interface{} `json:"file"`
+// WithPartialData returns a *PartialError instead of Errors when the
+// server reported errors alongside non-null data, as federated gateways
+// do when only some fields could be resolved. The response object is
+// populated with the data either way.
+func WithPartialData() ClientOption {
+	return func(client *Client) {
+		client.partialData = true
 	}
-	type filesVariables struct {
-		Files []interface{} `json:"files"`
+}
+
+// WithDataKey reads the data of results from key instead of data, for
+// servers that don't follow the specification. It applies to Run and
+// the other Run methods, and to batches, but not to streams and
+// subscriptions.
+func WithDataKey(key string) ClientOption {
+	return func(client *Client) {
+		client.dataKey = key
 	}
-	type emptyVariables struct {
+}
+
+// WithErrorsKey reads the errors of results from key instead of errors,
+// like WithDataKey.
+func WithErrorsKey(key string) ClientOption {
+	return func(client *Client) {
+		client.errorsKey = key
 	}
+}
 
-	query := new(multipartRequestSpecQuery)
-	query.Operations.Query = req.Query()
-	query.Map = make(map[string][]string)
+// WithResponseEnvelope reads results from the object at path in the
+// response instead of the response itself, for gateways wrapping them
+// as in {"result": {"data": {...}, "errors": [...]}}. The path is a
+// dotted list of keys, such as "result" or "payload.result". Responses
+// without the envelope, such as errors reported by the gateway itself,
+// are read as they are.
+// Like WithDataKey it applies to Run and the other Run methods, and to
+// each result of batches, but not to streams, subscriptions and
+// RunToWriter.
+func WithResponseEnvelope(path string) ClientOption {
+	return func(client *Client) {
+		client.responseEnvelope = path
+	}
+}
 
-	switch c := len(req.Files()); {
-	default:
-		fallthrough
-	case c == 0:
-		query.Operations.Variables = new(emptyVariables)
-		return *query
-	case c == 1:
-		variables := new(fileVariables)
-		variables.File = nil
-		query.Map[req.Files()[0].Field] = []string{`variables.file`}
-		query.Operations.Variables = variables
-		return *query
-	case c > 0:
-		variables := new(filesVariables)
-		for index, file := range req.Files() {
-			variables.Files = append(variables.Files, nil)
-			query.Map[file.Field] = []string{`variables.files.` + strconv.Itoa(index)}
-		}
-		query.Operations.Variables = variables
-		return *query
+// WithMethodOverride sets the X-HTTP-Method-Override header of every
+// request to its HTTP method, for proxies that require it. Requests are
+// still sent with their own method, for JSON and multipart bodies alike.
+func WithMethodOverride() ClientOption {
+	return func(client *Client) {
+		client.methodOverride = true
 	}
 }
 
-// WithHTTPClient specifies the underlying http.Client to use when
-// making requests.
-//  NewClient(endpoint, WithHTTPClient(specificHTTPClient))
-func WithHTTPClient(httpclient *http.Client) ClientOption {
+// WithMaxResponseBytes limits the size of response bodies, after
+// decompression, to n bytes. Larger responses fail with a
+// *ResponseTooLargeError instead of being read into memory.
+// By default the size is unlimited.
+func WithMaxResponseBytes(n int64) ClientOption {
 	return func(client *Client) {
-		client.httpClient = httpclient
+		client.maxResponseBytes = n
 	}
 }
 
-// UseMultipartForm uses multipart/form-data and activates support for
-// files.
-func UseMultipartForm() ClientOption {
+// WithResponseLimits limits the size of response bodies to maxBytes and
+// chooses whether the server may compress them with gzip, which is
+// decompressed transparently.
+// The limit applies to the decompressed body, not to the bytes received:
+// decompression stops as soon as the body exceeds maxBytes, and the
+// request fails with a *ResponseTooLargeError, so a small gzip body
+// expanding to a huge one is never held in memory. Without allowGzip,
+// responses are requested uncompressed and gzipped ones are rejected.
+// A maxBytes of zero or less leaves the size unlimited.
+//  NewClient(endpoint, WithResponseLimits(10<<20, true))
+func WithResponseLimits(maxBytes int64, allowGzip bool) ClientOption {
 	return func(client *Client) {
-		client.useMultipartForm = true
+		client.maxResponseBytes = maxBytes
+		client.noGzip = !allowGzip
 	}
 }
 
-// UseMultipartRequestSpec uses for files upload, implementing multipart request specification:
-// https://github.com/jaydenseric/graphql-multipart-request-spec
-// Variables doesn't supported: https://github.com/jaydenseric/graphql-multipart-request-spec/issues/22
-func UseMultipartRequestSpec() ClientOption {
+// errGzipNotAllowed is returned for a gzipped response when
+// WithResponseLimits doesn't allow gzip.
+var errGzipNotAllowed = errors.New("graphql: gzipped response not allowed")
+
+// checkEncoding checks that the response is not gzipped when the client
+// doesn't allow it.
+func (c *Client) checkEncoding(res *http.Response) error {
+	if c.noGzip && strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return errGzipNotAllowed
+	}
+	return nil
+}
+
+// WithTimeout bounds every request made by the client to d, including
+// retries. A shorter deadline already set on the context passed to Run
+// is kept.
+//  NewClient(endpoint, WithTimeout(10*time.Second))
+func WithTimeout(d time.Duration) ClientOption {
 	return func(client *Client) {
-		client.useMultipartRequestSpec = true
+		client.timeout = d
 	}
 }
 
@@ -379,6 +1974,25 @@ type Error struct {
 	Locations  []Location
 	Path       []interface{}
 	Extensions map[string]interface{}
+
+	// Raw holds the error object as received by Run and RunBatch, for
+	// the fields some servers add next to the ones of the specification.
+	// Use DecodeRaw to read them.
+	Raw json.RawMessage `json:"-"`
+}
+
+// DecodeRaw unmarshals the error object as received into v, such as a
+// struct with the fields the server adds to its errors:
+//  var custom struct {
+//      ErrorID   string `json:"errorId"`
+//      Retryable bool   `json:"retryable"`
+//  }
+//  err := gqlErr.DecodeRaw(&custom)
+func (e Error) DecodeRaw(v interface{}) error {
+	if len(e.Raw) == 0 {
+		return errors.New("graphql: error has no raw object")
+	}
+	return json.Unmarshal(e.Raw, v)
 }
 
 // Location represents error location in request
@@ -410,8 +2024,31 @@ func (l Errors) Error() string {
 }
 
 type graphResponse struct {
-	Data   interface{}
-	Errors Errors
+	Data       interface{}
+	Errors     Errors
+	Extensions map[string]interface{}
+
+	meta *ResponseMeta
+	raw  json.RawMessage
+}
+
+// ResponseMeta holds details of the HTTP response that carried
+// the GraphQL result.
+type ResponseMeta struct {
+	// StatusCode is the HTTP status code returned by the server.
+	StatusCode int
+	// Proto is the protocol of the response, such as "HTTP/2.0".
+	Proto string
+	// Header holds the HTTP response headers.
+	Header http.Header
+	// Cost is the query cost reported by the server in the X-GraphQL-Cost
+	// header or in extensions.cost, when HasCost is set.
+	Cost    float64
+	HasCost bool
+	// FromCache is set when the response of a GET request was served
+	// by an HTTP cache, as told by the Age, X-Cache, X-Cache-Status or
+	// CF-Cache-Status headers, or by WithResponseCache or WithETags.
+	FromCache bool
 }
 
 // Request is a GraphQL request.
@@ -419,13 +2056,48 @@ type Request struct {
 	q     string
 	vars  map[string]interface{}
 	files []File
+	// rawVars are sent as the variables instead of vars when set
+	rawVars json.RawMessage
+	// order holds the names of the variables set with VarOrdered, in
+	// the order they are encoded
+	order []string
 
 	// Header represent any request headers that will be set
-	// when the request is made.
+	// when the request is made. They replace the headers of the same
+	// name set by the client, such as Accept.
 	Header http.Header
 
-	body        bytes.Buffer
-	contentType string
+	// OpName is the name of the operation to execute when the query
+	// document contains several operations. It is sent as operationName
+	// when not empty.
+	OpName string
+
+	// extensions are sent in the extensions field of the request and
+	// omitQuery leaves out the query, as done for persisted queries
+	extensions  map[string]interface{}
+	omitQuery   bool
+	hash        string
+	hashedQuery string
+	// documentID is sent instead of the query when set
+	documentID string
+	// fragments holds the fragments added with AddFragment by name
+	fragments map[string]string
+	// noCache keeps the request out of the response cache and ETags
+	noCache bool
+
+	endpoint        string
+	method          string
+	url             string
+	body            bytes.Buffer
+	contentType     string
+	contentEncoding string
+	// writeBody writes a body streamed while it is sent instead of body,
+	// of contentLength bytes or -1 when unknown
+	writeBody     func(ctx context.Context, w io.Writer) error
+	contentLength int64
+	// replay holds the content of the files, in the same order, when
+	// they are sent more than once
+	replay []replayFile
 }
 
 // NewRequest makes a new Request with the specified string.
@@ -437,6 +2109,85 @@ func NewRequest(q string) *Request {
 	return req
 }
 
+// Clone returns a copy of the request that can be changed without
+// affecting req, for example to derive requests from a common base.
+// The variables, files and headers are copied, but the values of the
+// variables are shared. Cloned files share their reader with the files of
+// req, which can only be consumed once.
+func (req *Request) Clone() *Request {
+	clone := &Request{
+		q:          req.q,
+		Header:     req.Header.Clone(),
+		OpName:     req.OpName,
+		documentID: req.documentID,
+	}
+	if req.fragments != nil {
+		clone.fragments = make(map[string]string, len(req.fragments))
+		for name, body := range req.fragments {
+			clone.fragments[name] = body
+		}
+	}
+	if req.vars != nil {
+		clone.vars = make(map[string]interface{}, len(req.vars))
+		for key, value := range req.vars {
+			clone.vars[key] = value
+		}
+	}
+	if req.rawVars != nil {
+		clone.rawVars = append(json.RawMessage(nil), req.rawVars...)
+	}
+	if req.order != nil {
+		clone.order = append([]string(nil), req.order...)
+	}
+	if req.files != nil {
+		clone.files = append([]File(nil), req.files...)
+	}
+	return clone
+}
+
+// runCopy returns a copy of the request holding the state of a single
+// run, such as the rewritten query and the encoded body, so that req is
+// left unchanged and can be run concurrently. Unlike Clone, the
+// variables, files and headers are shared, and must not be changed on
+// the copy.
+func (req *Request) runCopy() *Request {
+	return &Request{
+		q:          req.q,
+		vars:       req.vars,
+		files:      req.files,
+		rawVars:    req.rawVars,
+		order:      req.order,
+		Header:     req.Header,
+		OpName:     req.OpName,
+		documentID: req.documentID,
+		fragments:  req.fragments,
+		noCache:    req.noCache,
+	}
+}
+
+// AddCookie adds a cookie to the request. Like http.Request.AddCookie,
+// only the name and value of the cookie are sent.
+func (req *Request) AddCookie(cookie *http.Cookie) {
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	s := (&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String()
+	if c := req.Header.Get("Cookie"); c != "" {
+		s = c + "; " + s
+	}
+	req.Header.Set("Cookie", s)
+}
+
+// SetIdempotencyKey sets the Idempotency-Key header of the request, so
+// the server can recognise a mutation sent again. Retries of the request
+// send the same key, and so do clones of the request.
+func (req *Request) SetIdempotencyKey(key string) {
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("Idempotency-Key", key)
+}
+
 // Var sets a variable.
 func (req *Request) Var(key string, value interface{}) {
 	if req.vars == nil {
@@ -445,7 +2196,171 @@ func (req *Request) Var(key string, value interface{}) {
 	req.vars[key] = value
 }
 
-// Vars gets the variables for this Request.
+// VarOrdered sets a variable like Var, and encodes the variables in a
+// fixed order: first those set with VarOrdered, in the order they were
+// first set, then the others sorted by name. The order is kept in every
+// encoding except the operations of multipart requests.
+//  req.VarOrdered("first", 1)
+//  req.VarOrdered("after", "cursor")
+func (req *Request) VarOrdered(key string, value interface{}) {
+	if !req.isOrdered(key) {
+		req.order = append(req.order, key)
+	}
+	req.Var(key, value)
+}
+
+func (req *Request) isOrdered(key string) bool {
+	for _, k := range req.order {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// orderedVariables encodes variables as a JSON object with its fields in
+// the order of keys, followed by the other variables sorted by name.
+type orderedVariables struct {
+	keys []string
+	vars map[string]interface{}
+}
+
+func (v orderedVariables) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, len(v.vars))
+	seen := make(map[string]bool, len(v.keys))
+	for _, key := range v.keys {
+		if _, ok := v.vars[key]; ok {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	rest := make([]string, 0, len(v.vars)-len(keys))
+	for key := range v.vars {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range append(keys, rest...) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(v.vars[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// SetRawVariables sets the variables of the request from a JSON object
+// already encoded, which is sent as is instead of the variables set with
+// Var: numbers keep their precision and fields their order. A request
+// can't have both; running it fails. A nil raw removes the raw variables.
+//  req.SetRawVariables(json.RawMessage(`{"id":9007199254740993}`))
+func (req *Request) SetRawVariables(raw json.RawMessage) {
+	req.rawVars = raw
+}
+
+// hasVariables reports whether the request has variables to send.
+func (req *Request) hasVariables() bool {
+	return req.rawVars != nil || len(req.vars) > 0
+}
+
+// variables gets the value encoded as the variables of the request, nil
+// when it has none.
+func (req *Request) variables() interface{} {
+	switch {
+	case req.rawVars != nil:
+		return req.rawVars
+	case req.order != nil && req.vars != nil:
+		return orderedVariables{keys: req.order, vars: req.vars}
+	case req.vars != nil:
+		return req.vars
+	}
+	return nil
+}
+
+// variableMap gets the variables of the request as a map, decoding the
+// raw variables with their numbers as json.Number.
+func (req *Request) variableMap() map[string]interface{} {
+	if req.rawVars == nil {
+		return req.vars
+	}
+	vars, _ := req.rawVariableMap()
+	return vars
+}
+
+func (req *Request) rawVariableMap() (map[string]interface{}, error) {
+	var vars map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(req.rawVars))
+	d.UseNumber()
+	if err := d.Decode(&vars); err != nil {
+		return nil, errors.Wrap(err, "graphql: invalid raw variables")
+	}
+	return vars, nil
+}
+
+// AddFragment appends the definition of the fragment named name to the
+// query, where body is its type condition and selection set. Adding a
+// fragment already added with the same body does nothing, so fragments
+// shared by several parts of a query can be added by each of them; an
+// error is returned when the bodies differ.
+//  req.AddFragment("HeroFields", "on Character { name friends { name } }")
+func (req *Request) AddFragment(name, body string) error {
+	body = strings.TrimSpace(body)
+	if existing, ok := req.fragments[name]; ok {
+		if existing != body {
+			return fmt.Errorf("graphql: fragment %s is already defined with another body", name)
+		}
+		return nil
+	}
+	if req.fragments == nil {
+		req.fragments = make(map[string]string)
+	}
+	req.fragments[name] = body
+	req.q += "\n\nfragment " + name + " " + body
+	return nil
+}
+
+// VarsFromStruct sets a variable for each field of the struct v, or the
+// struct v points to, named after its json tag as encoding/json would.
+// Variables set before are kept unless v has a field of the same name.
+func (req *Request) VarsFromStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("graphql: VarsFromStruct needs a struct, got %T", v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "encode variables")
+	}
+	var vars map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&vars); err != nil {
+		return errors.Wrap(err, "decode variables")
+	}
+	for key, value := range vars {
+		req.Var(key, value)
+	}
+	return nil
+}
+
+// Vars gets the variables for this Request set with Var.
 func (req *Request) Vars() map[string]interface{} {
 	return req.vars
 }
@@ -463,12 +2378,114 @@ func (req *Request) Query() string {
 // File sets a file to upload.
 // Files are only supported with a Client that was created with
 // the UseMultipartForm option.
+// With UseMultipartRequestSpec, the file is mapped to the variable named
+// fieldname when the operation declares it, as in
+// "mutation ($avatar: Upload!)", and otherwise to variables.file, or to
+// variables.files.N when the request has several such files. The
+// fieldname of each file must then be unique.
 func (req *Request) File(fieldname, filename string, r io.Reader) {
 	req.files = append(req.files, File{
-		Field: fieldname,
-		Name:  filename,
-		R:     r,
+		Field:    fieldname,
+		Name:     filename,
+		R:        r,
+		consumed: new(int32),
+	})
+}
+
+// FileWithType sets a file to upload with an explicit content type,
+// which is sent in the Content-Type header of the file part instead of
+// application/octet-stream.
+func (req *Request) FileWithType(fieldname, filename, contentType string, r io.Reader) {
+	req.files = append(req.files, File{
+		Field:       fieldname,
+		Name:        filename,
+		R:           r,
+		ContentType: contentType,
+		consumed:    new(int32),
+	})
+}
+
+// FileFromPath sets the file at path to upload, named after its base
+// name. The file is opened right away and closed once the request has
+// been run, whether it succeeded or not.
+func (req *Request) FileFromPath(fieldname, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "open file")
+	}
+	req.files = append(req.files, File{
+		Field:    fieldname,
+		Name:     filepath.Base(path),
+		R:        f,
+		opened:   true,
+		consumed: new(int32),
 	})
+	return nil
+}
+
+// removeReplay removes the content of the files kept for retries.
+func (req *Request) removeReplay() {
+	for _, f := range req.replay {
+		f.remove()
+	}
+	req.replay = nil
+}
+
+// closeFiles closes the files opened by FileFromPath.
+func (req *Request) closeFiles() {
+	for _, file := range req.files {
+		if !file.opened {
+			continue
+		}
+		if closer, ok := file.R.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// checkFiles checks that the readers of the files haven't been read by
+// an earlier run, which would send empty files.
+func (req *Request) checkFiles() error {
+	for _, file := range req.files {
+		if file.isConsumed() {
+			return fmt.Errorf("graphql: reader of file %q already consumed; create a fresh Request", file.Name)
+		}
+	}
+	return nil
+}
+
+// abortFiles closes the readers of the files that can be closed, when
+// the request is cancelled while its files are being read.
+func (req *Request) abortFiles() {
+	for _, file := range req.files {
+		if closer, ok := file.R.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// FileList sets files to upload as a list held by the single variable
+// named variable. With UseMultipartRequestSpec the files are mapped to
+// variables.<variable>.0, variables.<variable>.1 and so on.
+// Files without a Field are sent in the form field <variable>.N.
+func (req *Request) FileList(variable string, files ...File) {
+	index := 0
+	for _, file := range req.files {
+		if file.list == variable {
+			index++
+		}
+	}
+	for _, file := range files {
+		if file.Field == "" {
+			file.Field = variable + "." + strconv.Itoa(index)
+		}
+		file.list = variable
+		if file.consumed == nil {
+			file.consumed = new(int32)
+		}
+		req.files = append(req.files, file)
+		index++
+	}
 }
 
 // File represents a file to upload.
@@ -476,4 +2493,29 @@ type File struct {
 	Field string
 	Name  string
 	R     io.Reader
+
+	// ContentType is the MIME type of the file.
+	// When empty, application/octet-stream is used.
+	ContentType string
+
+	// list is the variable holding the file when added with FileList
+	list string
+	// opened is set for files opened by FileFromPath, which are closed
+	// once the request has been run
+	opened bool
+	// consumed is set to 1 once R has been read. It is shared by the
+	// copies of the file, such as those of a cloned Request.
+	consumed *int32
+}
+
+// markConsumed records that R has been read.
+func (f File) markConsumed() {
+	if f.consumed != nil {
+		atomic.StoreInt32(f.consumed, 1)
+	}
+}
+
+// isConsumed tells whether R has been read by an earlier run.
+func (f File) isConsumed() bool {
+	return f.consumed != nil && atomic.LoadInt32(f.consumed) == 1
 }
@@ -0,0 +1,82 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRunBatch(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Method, http.MethodPost)
+		is.Equal(r.Header.Get("X-Custom-Header"), "123")
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `[{"query":"query { a }","variables":null},{"query":"query B { b }","variables":{"key":"value"},"operationName":"B"}]`+"\n")
+		io.WriteString(w, `[
+			{"data": {"a": "yes"}},
+			{"errors": [{"message": "b failed"}]}
+		]`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	reqB := NewRequest("query B { b }")
+	reqB.Var("key", "value")
+	reqB.OpName = "B"
+	batch := NewBatch(NewRequest("query { a }"))
+	batch.Add(reqB)
+	batch.Header.Set("X-Custom-Header", "123")
+
+	var respA, respB map[string]interface{}
+	errs, err := client.RunBatch(ctx, batch, []interface{}{&respA, &respB})
+	is.NoErr(err)
+	is.Equal(calls, 1) // calls
+	is.Equal(len(errs), 2)
+	is.NoErr(errs[0])
+	is.Equal(respA["a"], "yes")
+	is.Equal(errs[1].Error(), "graphql: b failed")
+}
+
+func TestRunBatchErr(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `Internal Server Error`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	batch := NewBatch(NewRequest("query { a }"))
+	errs, err := client.RunBatch(ctx, batch, []interface{}{nil})
+	is.Equal(calls, 1) // calls
+	is.Equal(errs, nil)
+	is.Equal(err.Error(), "graphql: server returned a non-200 status code: 500")
+
+	_, err = client.RunBatch(ctx, batch, nil)
+	is.Equal(err.Error(), "graphql: batch has 1 requests but 0 responses")
+
+	req := NewRequest("query { a }")
+	req.File("file", "filename.txt", strings.NewReader(`This is a file`))
+	_, err = client.RunBatch(ctx, NewBatch(req), []interface{}{nil})
+	is.Equal(err.Error(), "cannot send files in a batch")
+	is.Equal(calls, 1) // calls
+}
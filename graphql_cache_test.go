@@ -0,0 +1,190 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestResponseCache(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute, 10))
+
+	for i := 0; i < 3; i++ {
+		req := NewRequest("query ($id: ID) { something }")
+		req.Var("id", "1")
+		var resp struct {
+			Something string
+		}
+		meta, err := client.RunWithMeta(ctx, req, &resp)
+		is.NoErr(err)
+		is.Equal(resp.Something, "yes")
+		is.Equal(meta.FromCache, i > 0) // from cache
+	}
+	is.Equal(calls, 1) // calls
+
+	req := NewRequest("query ($id: ID) { something }")
+	req.Var("id", "2")
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(calls, 2) // other variables are not cached
+
+	for i := 0; i < 2; i++ {
+		err := client.Run(ctx, NewRequest("mutation { something }"), nil)
+		is.NoErr(err)
+	}
+	is.Equal(calls, 4) // mutations are not cached
+}
+
+func TestResponseCacheErrors(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":null,"errors":[{"message":"boom"}]}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute, 10))
+
+	for i := 0; i < 2; i++ {
+		err := client.Run(ctx, NewRequest("query { something }"), nil)
+		is.True(err != nil)
+	}
+	is.Equal(calls, 2) // errors are not cached
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithResponseCache(20*time.Millisecond, 10))
+
+	err := client.Run(ctx, NewRequest("query { something }"), nil)
+	is.NoErr(err)
+	err = client.Run(ctx, NewRequest("query { something }"), nil)
+	is.NoErr(err)
+	is.Equal(calls, 1) // calls
+	time.Sleep(30 * time.Millisecond)
+	err = client.Run(ctx, NewRequest("query { something }"), nil)
+	is.NoErr(err)
+	is.Equal(calls, 2) // expired entry is fetched again
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute, 2))
+	run := func(q string) {
+		err := client.Run(ctx, NewRequest(q), nil)
+		is.NoErr(err)
+	}
+
+	run("query { a }")
+	run("query { b }")
+	run("query { a }") // a is now the most recently used
+	run("query { c }") // evicts b
+	is.Equal(calls, 3) // calls
+	run("query { a }")
+	run("query { c }")
+	is.Equal(calls, 3) // a and c are cached
+	run("query { b }")
+	is.Equal(calls, 4) // b was evicted
+}
+
+func TestResponseCacheIsolation(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-User", r.Header.Get("Authorization"))
+		io.WriteString(w, `{"data":{"tenant":"`+r.URL.Path+`","user":"`+r.Header.Get("Authorization")+`"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	type tenantKey struct{}
+	client := NewClient("", WithResponseCache(time.Minute, 10), WithEndpointResolver(func(ctx context.Context, req *Request) (string, error) {
+		return srv.URL + "/" + ctx.Value(tenantKey{}).(string), nil
+	}))
+	run := func(tenant, user string) (map[string]string, *ResponseMeta) {
+		req := NewRequest("query { tenant user }")
+		req.Header.Set("Authorization", user)
+		var resp map[string]string
+		meta, err := client.RunWithMeta(context.WithValue(ctx, tenantKey{}, tenant), req, &resp)
+		is.NoErr(err)
+		return resp, meta
+	}
+
+	resp, _ := run("a", "alice")
+	is.Equal(resp["tenant"], "/a")
+	resp, _ = run("b", "alice")
+	is.Equal(resp["tenant"], "/b") // other endpoint
+	resp, _ = run("a", "bob")
+	is.Equal(resp["user"], "bob") // other credentials
+	is.Equal(calls, 3)
+
+	resp, meta := run("a", "alice")
+	is.Equal(calls, 3) // cached
+	is.True(meta.FromCache)
+	is.Equal(resp["user"], "alice")
+	meta.Header.Set("X-User", "changed")
+	_, meta = run("a", "alice")
+	is.Equal(meta.Header.Get("X-User"), "alice") // cached header is copied
+}
+
+func TestResponseCacheNoTTL(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithResponseCache(0, 10))
+	for i := 0; i < 2; i++ {
+		is.NoErr(client.Run(ctx, NewRequest("query { something }"), nil))
+	}
+	is.Equal(calls, 2) // disabled
+}
@@ -0,0 +1,74 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	down := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithCircuitBreaker(2, 50*time.Millisecond))
+	var statusErr *StatusError
+	is.True(errors.As(client.Run(ctx, NewRequest("query {}"), nil), &statusErr))
+	is.True(errors.As(client.Run(ctx, NewRequest("query {}"), nil), &statusErr))
+
+	// open
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	var open *CircuitOpenError
+	is.True(errors.As(err, &open))
+	is.True(open.Until.After(time.Now()))
+	is.Equal(calls, 2)
+
+	// the probe fails and opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	is.True(errors.As(client.Run(ctx, NewRequest("query {}"), nil), &statusErr))
+	is.True(errors.As(client.Run(ctx, NewRequest("query {}"), nil), &open))
+	is.Equal(calls, 3)
+
+	// the probe succeeds and closes the circuit
+	down = false
+	time.Sleep(60 * time.Millisecond)
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.Equal(calls, 5)
+}
+
+func TestCircuitBreakerGraphQLErrors(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"errors":[{"message":"boom"}]}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithCircuitBreaker(1, time.Minute))
+	for i := 0; i < 3; i++ {
+		err := client.Run(ctx, NewRequest("query {}"), nil)
+		is.Equal(err.Error(), "graphql: boom")
+	}
+	is.Equal(calls, 3)
+}
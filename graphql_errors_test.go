@@ -0,0 +1,119 @@
+package graphql
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestErrorsForPath(t *testing.T) {
+	is := is.New(t)
+
+	errs := Errors{
+		{Message: "a", Path: []interface{}{"hero", "heroFriends", 1.0, "name"}},
+		{Message: "b", Path: []interface{}{"hero", "heroFriends", 2.0, "name"}},
+		{Message: "c", Path: []interface{}{"villain"}},
+		{Message: "d"},
+	}
+	is.Equal(len(errs.ForPath("hero")), 2)
+	is.Equal(errs.ForPath("hero", "heroFriends", 1), []Error{errs[0]})
+	is.Equal(errs.ForPath("villain", "name"), []Error(nil))
+	is.Equal(len(errs.ForPath()), 4)
+
+	errs = Errors{
+		{Message: "a", Path: []interface{}{"hero", json.Number("1")}},
+		{Message: "b", Path: []interface{}{"hero", []interface{}{1}}},
+	}
+	is.Equal(errs.ForPath("hero", 1), []Error{errs[0]})
+	is.Equal(errs.ForPath("hero", json.Number("1")), []Error{errs[0]})
+	is.Equal(errs.ForPath("hero", []interface{}{1}), []Error(nil)) // not comparable
+}
+
+func TestErrorsHasExtensionCode(t *testing.T) {
+	is := is.New(t)
+
+	errs := Errors{
+		{Message: "a", Extensions: map[string]interface{}{"code": "UNAUTHENTICATED"}},
+		{Message: "b"},
+	}
+	is.True(errs.HasExtensionCode("UNAUTHENTICATED"))
+	is.True(!errs.HasExtensionCode("BAD_USER_INPUT"))
+}
+
+func TestErrorsIs(t *testing.T) {
+	is := is.New(t)
+
+	errs := Errors{
+		{Message: "a", Extensions: map[string]interface{}{"code": "UNAUTHENTICATED"}},
+		{Message: "b", Extensions: map[string]interface{}{"code": "RATE_LIMITED"}},
+		{Message: "c"},
+	}
+	is.True(errors.Is(errs, ErrUnauthenticated))
+	is.True(errors.Is(errs, ErrorCode("RATE_LIMITED")))
+	is.True(!errors.Is(errs, ErrForbidden))
+	is.True(!errors.Is(errs, ErrorCode("")))
+	is.True(errors.Is(errs[0], ErrUnauthenticated))
+	is.True(!errors.Is(errs[2], ErrUnauthenticated))
+
+	var err error = &StatusError{StatusCode: 401, Errors: errs}
+	is.True(errors.Is(errors.Wrap(err, "query"), ErrUnauthenticated))
+	is.True(!errors.Is(&StatusError{StatusCode: 500}, ErrInternalServerError))
+	is.Equal(ErrBadUserInput.Error(), "graphql: error code BAD_USER_INPUT")
+}
+
+func TestErrorExtensions(t *testing.T) {
+	is := is.New(t)
+
+	var e Error
+	err := json.Unmarshal([]byte(`{
+		"message": "boom",
+		"extensions": {
+			"code": "INTERNAL_SERVER_ERROR",
+			"retryAfter": 30,
+			"ratio": 0.5,
+			"exception": {"stacktrace": "at main", "line": 12}
+		}
+	}`), &e)
+	is.NoErr(err)
+
+	is.Equal(e.Code(), "INTERNAL_SERVER_ERROR")
+	s, ok := e.ExtensionString("exception.stacktrace")
+	is.True(ok)
+	is.Equal(s, "at main")
+	n, ok := e.ExtensionInt("retryAfter")
+	is.True(ok)
+	is.Equal(n, int64(30))
+	n, ok = e.ExtensionInt("exception.line")
+	is.True(ok)
+	is.Equal(n, int64(12))
+
+	_, ok = e.ExtensionInt("ratio")
+	is.True(!ok)
+	_, ok = e.ExtensionInt("code")
+	is.True(!ok)
+	_, ok = e.ExtensionString("exception.stacktrace.frames")
+	is.True(!ok)
+	_, ok = e.ExtensionString("missing")
+	is.True(!ok)
+	is.Equal(Error{Message: "no extensions"}.Code(), "")
+}
+
+func TestErrorFormatLocation(t *testing.T) {
+	is := is.New(t)
+
+	query := "query {\n\theroo {\r\n\t\tname\n\t}\n}"
+	e := Error{
+		Message:   `Cannot query field "heroo" on type "Query".`,
+		Locations: []Location{{Line: 2, Column: 2}, {Line: 3, Column: 3}, {Line: 12, Column: 1}},
+	}
+	is.Equal(e.FormatLocation(query), "2 | \theroo {\n  | \t^\n3 | \t\tname\n  | \t\t^\n12:1")
+
+	client := NewClient("", WithQueryTransform(func(q string) (string, error) {
+		return "# transformed\n" + q, nil
+	}))
+	e.Locations = []Location{{Line: 1, Column: 3}}
+	is.Equal(client.FormatError(NewRequest(query), e), "graphql: Cannot query field \"heroo\" on type \"Query\".\n1 | # transformed\n  |   ^")
+	is.Equal(client.FormatError(NewRequest(query), Error{Message: "boom"}), "graphql: boom")
+}
@@ -0,0 +1,57 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestEventChannel(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Fail") != "" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	events := make(chan Event, 2)
+	client := NewClient(srv.URL, WithEventChannel(events))
+
+	req := NewRequest("query Hero($password: String) { hero }")
+	req.Var("password", "secret")
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+	req = NewRequest("query Villain { villain }")
+	req.Header.Set("Fail", "yes")
+	failed := client.Run(ctx, req, nil)
+	is.True(failed != nil)
+	err = client.Run(ctx, NewRequest("query Dropped { dropped }"), nil)
+	is.NoErr(err) // the channel is full
+	is.Equal(len(events), 2)
+
+	e := <-events
+	is.Equal(e.Operation, "Hero")
+	is.Equal(e.Query, "query Hero($password: String) { hero }")
+	is.Equal(e.Variables, map[string]interface{}{"password": "secret"})
+	is.Equal(e.StatusCode, http.StatusOK)
+	is.Equal(e.ResponseBytes, len(`{"data":{"something":"yes"}}`))
+	is.True(e.Duration > 0)
+	is.True(!e.Start.IsZero())
+	is.NoErr(e.Err)
+
+	e = <-events
+	is.Equal(e.Operation, "Villain")
+	is.Equal(e.StatusCode, http.StatusBadGateway)
+	is.Equal(e.Err, failed)
+}
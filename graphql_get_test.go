@@ -0,0 +1,226 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestGETForQueries(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Method, http.MethodGet)
+		is.Equal(r.URL.Query().Get("query"), "query Items($key: String!) {}")
+		is.Equal(r.URL.Query().Get("variables"), `{"key":"value"}`)
+		is.Equal(r.URL.Query().Get("operationName"), "Items")
+		is.Equal(r.URL.Query().Get("tenant"), "abc")
+		is.Equal(r.Header.Get("Content-Type"), "")
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL+"?tenant=abc", UseGETForQueries())
+
+	req := NewRequest("query Items($key: String!) {}")
+	req.Var("key", "value")
+	req.OpName = "Items"
+	var responseData map[string]interface{}
+	err := client.Run(ctx, req, &responseData)
+	is.NoErr(err)
+	is.Equal(calls, 1) // calls
+	is.Equal(responseData["something"], "yes")
+}
+
+func TestGETForQueriesMutation(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Method, http.MethodPost)
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `{"query":"mutation { doIt }","variables":null}`+"\n")
+		io.WriteString(w, `{"data":{"doIt":true}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseGETForQueries())
+
+	err := client.Run(ctx, NewRequest("mutation { doIt }"), nil)
+	is.NoErr(err)
+	is.Equal(calls, 1) // calls
+}
+
+func TestMethods(t *testing.T) {
+	is := is.New(t)
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		switch r.Method {
+		case http.MethodGet:
+			is.Equal(len(b), 0)
+			is.Equal(r.URL.Query().Get("query"), "query { something }")
+		case http.MethodPut:
+			is.Equal(string(b), `{"query":"mutation { doIt }","variables":null}`+"\n")
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithMethods(http.MethodGet, http.MethodPut))
+	is.NoErr(client.Run(ctx, NewRequest("query { something }"), nil))
+	is.NoErr(client.Run(ctx, NewRequest("mutation { doIt }"), nil))
+	is.NoErr(client.Run(ctx, NewRequest("subscription { events }"), nil))
+
+	client = NewClient(srv.URL, WithMethods("", ""))
+	is.NoErr(client.Run(ctx, NewRequest("query { something }"), nil))
+	is.Equal(methods, []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodPost})
+}
+
+func TestGETForQueriesFallbackToPOST(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Method, http.MethodPost)
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseGETForQueries(), WithGETMaxURLLength(64))
+
+	req := NewRequest("{ " + strings.Repeat("field ", 20) + "}")
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(calls, 1) // calls
+}
+
+func TestGETForQueriesFromCache(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 2:
+			w.Header().Set("X-Cache", "HIT from proxy")
+		case 3:
+			w.Header().Set("Age", "12")
+		case 4:
+			w.Header().Set("X-Cache", "MISS")
+		case 5:
+			w.Header().Set("X-Cache", "HIT")
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseGETForQueries())
+
+	var fromCache []bool
+	for i := 0; i < 4; i++ {
+		meta, err := client.RunWithMeta(ctx, NewRequest("query {}"), nil)
+		is.NoErr(err)
+		fromCache = append(fromCache, meta.FromCache)
+	}
+	is.Equal(fromCache, []bool{false, true, true, false})
+
+	// only meaningful for GET requests
+	client = NewClient(srv.URL)
+	meta, err := client.RunWithMeta(ctx, NewRequest("query {}"), nil)
+	is.NoErr(err)
+	is.True(!meta.FromCache)
+	is.Equal(calls, 5)
+}
+
+func TestETags(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	var conditions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		conditions = append(conditions, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` && r.URL.Query().Get("variables") == `{"key":"value"}` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseGETForQueries(), WithETags(10))
+
+	run := func(key string) (*ResponseMeta, map[string]interface{}) {
+		req := NewRequest("query Items($key: String!) {}")
+		req.Var("key", key)
+		var responseData map[string]interface{}
+		meta, err := client.RunWithMeta(ctx, req, &responseData)
+		is.NoErr(err)
+		return meta, responseData
+	}
+	meta, responseData := run("value")
+	is.True(!meta.FromCache)
+	is.Equal(responseData["something"], "yes")
+	meta, responseData = run("value")
+	is.True(meta.FromCache)
+	is.Equal(meta.StatusCode, http.StatusNotModified)
+	is.Equal(responseData["something"], "yes")
+	_, responseData = run("other")
+	is.Equal(responseData["something"], "yes")
+	is.Equal(calls, 3) // calls
+	is.Equal(conditions, []string{"", `"v1"`, ""})
+}
+
+func TestETagsPerCredentials(t *testing.T) {
+	is := is.New(t)
+	var conditions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditions = append(conditions, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, `{"data":{"user":"`+r.Header.Get("Authorization")+`"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseGETForQueries(), WithETags(10))
+
+	run := func(authorization string) string {
+		req := NewRequest("query { user }")
+		req.Header.Set("Authorization", authorization)
+		var responseData struct{ User string }
+		is.NoErr(client.Run(ctx, req, &responseData))
+		return responseData.User
+	}
+	is.Equal(run("Bearer alice"), "Bearer alice")
+	is.Equal(run("Bearer bob"), "Bearer bob") // not the response of alice
+	is.Equal(run("Bearer alice"), "Bearer alice")
+	is.Equal(conditions, []string{"", "", `"v1"`})
+}
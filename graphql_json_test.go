@@ -1,15 +1,25 @@
 package graphql
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/matryer/is"
+	"github.com/pkg/errors"
 )
 
 func TestDoJSON(t *testing.T) {
@@ -64,6 +74,12 @@ func TestDoJSONServerError(t *testing.T) {
 	err := client.Run(ctx, &Request{q: "query {}"}, &responseData)
 	is.Equal(calls, 1) // calls
 	is.Equal(err.Error(), "graphql: server returned a non-200 status code: 500")
+	var statusErr *StatusError
+	is.True(errors.As(err, &statusErr))
+	is.Equal(statusErr.StatusCode, http.StatusInternalServerError)
+	is.Equal(string(statusErr.Body), `Internal Server Error`)
+	var errs Errors
+	is.True(!errors.As(err, &errs))
 }
 
 func TestDoJSONBadRequestErr(t *testing.T) {
@@ -129,8 +145,11 @@ func TestDoJSONBadRequestErrDetails(t *testing.T) {
 	var responseData map[string]interface{}
 	err := client.Run(ctx, &Request{q: "query {}"}, &responseData)
 	is.Equal(calls, 1) // calls
-	errs, ok := err.(Errors)
-	is.True(ok)
+	var statusErr *StatusError
+	is.True(errors.As(err, &statusErr))
+	is.Equal(statusErr.StatusCode, http.StatusBadRequest)
+	var errs Errors
+	is.True(errors.As(err, &errs))
 	is.Equal(len(errs), 1)
 	e := errs[0]
 	is.Equal(e.Message, "Name for character with ID 1002 could not be fetched.")
@@ -206,3 +225,1790 @@ func TestHeader(t *testing.T) {
 
 	is.Equal(resp.Value, "some data")
 }
+
+func TestRunWithMeta(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := io.WriteString(w, `{"data":{"value":"some data"},"errors":[{"message":"partial failure"}]}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+
+	var resp struct {
+		Value string
+	}
+	meta, err := client.RunWithMeta(ctx, NewRequest("query {}"), &resp)
+	is.Equal(err.Error(), "graphql: partial failure")
+	is.Equal(calls, 1)
+	is.True(meta != nil)
+	is.Equal(meta.StatusCode, http.StatusBadRequest)
+	is.Equal(meta.Header.Get("X-RateLimit-Remaining"), "42")
+	is.Equal(resp.Value, "some data")
+}
+
+func TestRunWithMetaCost(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("X-GraphQL-Cost", "12.5")
+			io.WriteString(w, `{"data":{},"extensions":{"cost":99}}`)
+		case 2:
+			io.WriteString(w, `{"data":{},"extensions":{"cost":7}}`)
+		case 3:
+			io.WriteString(w, `{"data":{},"extensions":{"cost":{"requestedQueryCost":10,"actualQueryCost":4}}}`)
+		default:
+			io.WriteString(w, `{"data":{}}`)
+		}
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+	for _, want := range []float64{12.5, 7, 4} {
+		meta, err := client.RunWithMeta(ctx, NewRequest("query {}"), nil)
+		is.NoErr(err)
+		is.True(meta.HasCost)
+		is.Equal(meta.Cost, want)
+	}
+	meta, err := client.RunWithMeta(ctx, NewRequest("query {}"), nil)
+	is.NoErr(err)
+	is.True(!meta.HasCost)
+	is.Equal(calls, 4)
+
+	// numbers kept as json.Number
+	cost, ok := responseCost(http.Header{}, map[string]interface{}{"cost": json.Number("3")})
+	is.True(ok)
+	is.Equal(cost, 3.0)
+	cost, ok = responseCost(http.Header{}, map[string]interface{}{"cost": map[string]interface{}{"requestedQueryCost": json.Number("10")}})
+	is.True(ok)
+	is.Equal(cost, 10.0)
+}
+
+func TestOperationNameJSON(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `{"query":"query A {} query B {}","variables":null,"operationName":"B"}`+"\n")
+		_, err = io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+
+	req := NewRequest("query A {} query B {}")
+	req.OpName = "B"
+
+	var resp struct {
+		Value string
+	}
+	err := client.Run(ctx, req, &resp)
+	is.NoErr(err)
+	is.Equal(calls, 1)
+	is.Equal(resp.Value, "some data")
+}
+
+func TestRunWithExtensions(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, err := io.WriteString(w, `{"data":{"value":"some data"},"extensions":{"cost":{"requestedQueryCost":3}}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+
+	var resp struct {
+		Value string
+	}
+	extensions, err := client.RunWithExtensions(ctx, NewRequest("query {}"), &resp)
+	is.NoErr(err)
+	is.Equal(calls, 1)
+	is.Equal(resp.Value, "some data")
+	is.Equal(extensions, map[string]interface{}{
+		"cost": map[string]interface{}{"requestedQueryCost": 3.0},
+	})
+}
+
+func TestRequestCompression(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body := r.Body
+		if calls == 1 {
+			is.Equal(r.Header.Get("Content-Encoding"), "gzip")
+			zr, err := gzip.NewReader(r.Body)
+			is.NoErr(err)
+			body = zr
+		} else {
+			is.Equal(r.Header.Get("Content-Encoding"), "")
+		}
+		b, err := ioutil.ReadAll(body)
+		is.NoErr(err)
+		is.True(strings.HasPrefix(string(b), `{"query":"query {}","variables":`))
+		_, err = io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithRequestCompression(), WithRequestCompressionMinBytes(64))
+
+	req := NewRequest("query {}")
+	req.Var("blob", strings.Repeat("a", 64))
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+
+	err = client.Run(ctx, NewRequest("query {}"), nil)
+	is.NoErr(err)
+	is.Equal(calls, 2)
+}
+
+func TestGzipResponse(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("Accept-Encoding"), "gzip")
+		if calls == 2 {
+			// server ignoring Accept-Encoding
+			_, err := io.WriteString(w, `{"data":{"value":"plain data"}}`)
+			is.NoErr(err)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		_, err := io.WriteString(zw, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+		is.NoErr(zw.Close())
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, UseMultipartForm())
+
+	var resp struct {
+		Value string
+	}
+	err := client.Run(ctx, NewRequest("query {}"), &resp)
+	is.NoErr(err)
+	is.Equal(resp.Value, "some data")
+
+	client = NewClient(srv.URL)
+	err = client.Run(ctx, NewRequest("query {}"), &resp)
+	is.NoErr(err)
+	is.Equal(resp.Value, "plain data")
+
+	err = client.Run(ctx, NewRequest("query {}"), &resp)
+	is.NoErr(err)
+	is.Equal(resp.Value, "some data")
+	is.Equal(calls, 3)
+}
+
+func TestResponseBodyDrained(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		// a body that fails to decompress is left unread by the client,
+		// and drained when small enough
+		w.Header().Set("Content-Encoding", "gzip")
+		_, err := io.WriteString(w, strings.Repeat("not gzip ", 1<<12))
+		is.NoErr(err)
+	}))
+	var conns int
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns++
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+	for i := 0; i < 3; i++ {
+		err := client.Run(ctx, NewRequest("query {}"), nil)
+		is.True(err != nil)
+	}
+	is.Equal(calls, 3)
+	is.Equal(conns, 1) // connection reused
+}
+
+func TestClientHeaders(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header["X-Tenant"], []string{"acme", "other"})
+		if calls == 1 {
+			is.Equal(r.Header.Get("Authorization"), "Bearer token")
+		} else {
+			is.Equal(r.Header["Authorization"], []string{"Bearer override"})
+		}
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithBearerToken("token"), WithHeader("X-Tenant", "acme"), WithHeader("X-Tenant", "other"))
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.NoErr(err)
+
+	req := NewRequest("query {}")
+	req.Header.Set("Authorization", "Bearer override")
+	err = client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(calls, 2)
+}
+
+func TestUserAgent(t *testing.T) {
+	is := is.New(t)
+
+	var agents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithUserAgent("billing-service/1.2"))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+
+	req := NewRequest("query {}")
+	req.Header.Set("User-Agent", "override/1.0")
+	is.NoErr(client.Run(ctx, req, nil))
+
+	client = NewClient(srv.URL, WithUserAgent("billing-service/1.2"), UseMultipartForm())
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+
+	is.Equal(agents, []string{"billing-service/1.2", "override/1.0", "billing-service/1.2"})
+}
+
+func TestClientInfo(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("apollographql-client-name"), "web")
+		is.Equal(r.Header.Get("apollographql-client-version"), "1.4.0")
+		is.Equal(r.Header.Get("User-Agent"), "web/1.4.0")
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithClientInfo("web", "1.4.0"), WithUserAgent("web/1.4.0"))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.Equal(calls, 1)
+}
+
+func TestTokenProvider(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("Authorization"), "Bearer token-"+strconv.Itoa(calls))
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	var tokens int
+	var tokenErr error
+	client := NewClient(srv.URL, WithTokenProvider(func(ctx context.Context) (string, error) {
+		tokens++
+		return "token-" + strconv.Itoa(tokens), tokenErr
+	}))
+
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+
+	tokenErr = errors.New("refresh failed")
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.Equal(err.Error(), "token provider: refresh failed")
+	is.Equal(calls, 2)
+}
+
+func TestAPIKey(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("X-API-Key"), "secret")
+		is.Equal(r.Header.Get("Service-Key"), "other-secret")
+		is.Equal(r.Header.Get("Authorization"), "Bearer token")
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithAPIKey("", "secret"), WithAPIKey("Service-Key", "other-secret"), WithTokenProvider(func(ctx context.Context) (string, error) {
+		return "token", nil
+	}))
+	var logs []string
+	client.Log = func(s string) {
+		logs = append(logs, s)
+	}
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	var headers string
+	for _, l := range logs {
+		if strings.Contains(l, "] >> headers: ") {
+			headers = l
+		}
+	}
+	is.True(strings.Contains(headers, "Service-Key:[[REDACTED]]"))
+	is.True(strings.Contains(headers, "X-Api-Key:[[REDACTED]]"))
+}
+
+func TestHeaderFromContext(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("X-Request-ID"), "req-1")
+		is.Equal(r.Header.Get("X-Tenant"), "from-context")
+		is.Equal(r.Header.Get("X-Trace"), "from-request")
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+
+	type ctxKey struct{}
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "req-1"), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL,
+		WithHeader("X-Tenant", "from-client"),
+		WithHeaderFromContext(func(ctx context.Context) http.Header {
+			return http.Header{
+				"X-Request-ID": {ctx.Value(ctxKey{}).(string)},
+				"X-Tenant":     {"from-context"},
+				"X-Trace":      {"from-context"},
+			}
+		}),
+	)
+
+	req := NewRequest("query {}")
+	req.Header.Set("X-Trace", "from-request")
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(calls, 1)
+}
+
+func TestRunRaw(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, err := io.WriteString(w, `{"data":{"value":"some data"},"errors":[{"message":"partial failure"}]}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+
+	raw, err := client.RunRaw(ctx, NewRequest("query {}"))
+	is.Equal(calls, 1)
+	is.Equal(string(raw), `{"data":{"value":"some data"},"errors":[{"message":"partial failure"}]}`)
+	errs, ok := err.(Errors)
+	is.True(ok)
+	is.Equal(errs[0].Message, "partial failure")
+}
+
+func TestJSONEncoderDecoder(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `{"query":"query {}","variables":{"id":12345678901234567890}}`)
+		_, err = io.WriteString(w, `{"data":{"id":12345678901234567890}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL,
+		WithJSONEncoder(func(w io.Writer, v interface{}) error {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			return err
+		}),
+		WithJSONDecoder(func(r io.Reader, v interface{}) error {
+			d := json.NewDecoder(r)
+			d.UseNumber()
+			return d.Decode(v)
+		}),
+	)
+
+	req := NewRequest("query {}")
+	req.Var("id", json.Number("12345678901234567890"))
+	var resp map[string]interface{}
+	err := client.Run(ctx, req, &resp)
+	is.NoErr(err)
+	is.Equal(calls, 1)
+	is.Equal(resp["id"], json.Number("12345678901234567890"))
+}
+
+func TestResponseValidator(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/html")
+		_, err := io.WriteString(w, `<html>Bad Gateway</html>`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithResponseValidator(func(res *http.Response) error {
+		b, err := ioutil.ReadAll(res.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `<html>Bad Gateway</html>`)
+		if !strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") {
+			return errors.New("unexpected content type " + res.Header.Get("Content-Type"))
+		}
+		return nil
+	}))
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.Equal(calls, 1)
+	is.Equal(err.Error(), "unexpected content type text/html")
+}
+
+func TestClientTimeout(t *testing.T) {
+	is := is.New(t)
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewClient(srv.URL, WithTimeout(50*time.Millisecond))
+	start := time.Now()
+	err := client.Run(context.Background(), NewRequest("query {}"), nil)
+	is.True(err != nil)
+	is.True(errors.Is(err, context.DeadlineExceeded))
+	is.True(time.Since(start) < 1*time.Second)
+
+	// a shorter deadline on the context is honoured
+	client = NewClient(srv.URL, WithTimeout(10*time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = client.Run(ctx, NewRequest("query {}"), nil)
+	is.True(errors.Is(err, context.DeadlineExceeded))
+	is.True(time.Since(start) < 1*time.Second)
+	var timeout *TimeoutError
+	is.True(errors.As(err, &timeout))
+
+	// cancellation is told apart from timeouts
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = client.Run(ctx, NewRequest("query {}"), nil)
+	is.True(errors.Is(err, context.Canceled))
+	var canceled *CanceledError
+	is.True(errors.As(err, &canceled))
+	is.True(!errors.As(err, &timeout))
+}
+
+func TestPrepare(t *testing.T) {
+	is := is.New(t)
+
+	client := NewClient("https://example.com/graphql", WithHeader("X-Tenant", "acme"))
+	req := NewRequest("query ($id: ID!) { node(id: $id) { id } }")
+	req.Var("id", "123")
+	req.Header.Set("X-Request-ID", "abc")
+
+	r, err := client.Prepare(context.Background(), req)
+	is.NoErr(err)
+	is.Equal(r.Method, http.MethodPost)
+	is.Equal(r.URL.String(), "https://example.com/graphql")
+	is.Equal(r.Header.Get("Content-Type"), "application/json; charset=utf-8")
+	is.Equal(r.Header.Get("X-Tenant"), "acme")
+	is.Equal(r.Header.Get("X-Request-ID"), "abc")
+	b, err := ioutil.ReadAll(r.Body)
+	is.NoErr(err)
+	is.Equal(string(b), `{"query":"query ($id: ID!) { node(id: $id) { id } }","variables":{"id":"123"}}`+"\n")
+}
+
+func TestStructuredLog(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	var entries []LogEntry
+	var logs []string
+	client := NewClient(srv.URL, WithStructuredLog(func(e LogEntry) {
+		entries = append(entries, e)
+	}))
+	client.Log = func(s string) {
+		logs = append(logs, s)
+	}
+
+	err := client.Run(context.Background(), NewRequest("query {}"), nil)
+	is.NoErr(err)
+	is.Equal(len(entries), 2)
+	is.Equal(entries[0].Phase, LogPhaseRequest)
+	is.Equal(entries[0].Method, http.MethodPost)
+	is.Equal(entries[0].URL, srv.URL)
+	is.Equal(entries[0].Bytes, len(`{"query":"query {}","variables":null}`+"\n"))
+	is.Equal(entries[1].Phase, LogPhaseResponse)
+	is.Equal(entries[1].StatusCode, http.StatusOK)
+	is.Equal(entries[1].Bytes, len(`{"data":{"something":"yes"}}`))
+	is.True(entries[1].Duration >= 10*time.Millisecond)
+	is.NoErr(entries[1].Err)
+	is.True(len(logs) > 0)
+}
+
+func TestRunInto(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, err := io.WriteString(w, `{"data":{"viewer":{"organization":{"repositories":[{"name":"one"},{"name":"two"}]}}}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+
+	var repos []struct{ Name string }
+	err := client.RunInto(ctx, NewRequest("query {}"), "viewer.organization.repositories", &repos)
+	is.NoErr(err)
+	is.Equal(len(repos), 2)
+	is.Equal(repos[1].Name, "two")
+
+	var name string
+	err = client.RunInto(ctx, NewRequest("query {}"), "viewer.organization.repositories.0.name", &name)
+	is.NoErr(err)
+	is.Equal(name, "one")
+
+	err = client.RunInto(ctx, NewRequest("query {}"), "viewer.user", &name)
+	is.Equal(err.Error(), `graphql: path "viewer.user" not found in response data`)
+	err = client.RunInto(ctx, NewRequest("query {}"), "viewer.organization.repositories.2", &name)
+	is.Equal(err.Error(), `graphql: path "viewer.organization.repositories.2" not found in response data`)
+	is.Equal(calls, 4)
+}
+
+func TestLocalVariableCheck(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithLocalVariableCheck())
+	req := NewRequest(`query ($key: String!) { items(id: $key) { id } }`)
+	req.Var("kye", "value")
+	err := client.Run(ctx, req, nil)
+	is.Equal(err.Error(), "graphql: missing value for variable $key of type String!")
+	is.Equal(calls, 0)
+
+	req.Var("key", "value")
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(calls, 1)
+}
+
+func TestPartialData(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Get("null") != "" {
+			_, err := io.WriteString(w, `{"data":null,"errors":[{"message":"boom"}]}`)
+			is.NoErr(err)
+			return
+		}
+		_, err := io.WriteString(w, `{"data":{"user":{"name":"Mat"},"reviews":null},"errors":[{"message":"reviews unavailable","path":["reviews"]}]}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithPartialData())
+	var resp struct {
+		User struct {
+			Name string
+		}
+	}
+	err := client.Run(ctx, NewRequest("query {}"), &resp)
+	is.Equal(resp.User.Name, "Mat")
+	var partial *PartialError
+	is.True(errors.As(err, &partial))
+	is.Equal(partial.Errors[0].Message, "reviews unavailable")
+	is.Equal(string(partial.Data), `{"user":{"name":"Mat"},"reviews":null}`)
+	is.Equal(err.Error(), "graphql: reviews unavailable")
+	var errs Errors
+	is.True(errors.As(err, &errs))
+
+	var name string
+	err = client.RunInto(ctx, NewRequest("query {}"), "user.name", &name)
+	is.True(errors.As(err, &partial))
+	is.Equal(name, "Mat")
+
+	client = NewClient(srv.URL+"?null=1", WithPartialData())
+	err = client.Run(ctx, NewRequest("query {}"), nil)
+	is.True(!errors.As(err, &partial))
+	is.True(errors.As(err, &errs))
+	is.Equal(calls, 3)
+}
+
+func TestMethodOverride(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Method, http.MethodPost)
+		is.Equal(r.Header.Get("X-HTTP-Method-Override"), http.MethodPost)
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithMethodOverride())
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+
+	client = NewClient(srv.URL, WithMethodOverride(), UseMultipartForm())
+	req := NewRequest("query {}")
+	req.File("file", "filename.txt", strings.NewReader(`This is a file`))
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(calls, 2)
+}
+
+func TestRequestClone(t *testing.T) {
+	is := is.New(t)
+
+	base := NewRequest("query ($id: ID!) { node(id: $id) { id } }")
+	base.Var("id", "1")
+	base.Header.Set("X-Tenant", "acme")
+	base.OpName = "Node"
+	base.File("file", "filename.txt", strings.NewReader(`This is a file`))
+
+	clone := base.Clone()
+	clone.Var("id", "2")
+	clone.Header.Set("X-Tenant", "other")
+	clone.File("other", "other.txt", strings.NewReader(`This is another file`))
+
+	is.Equal(clone.Query(), base.Query())
+	is.Equal(clone.OpName, "Node")
+	is.Equal(base.Vars()["id"], "1")
+	is.Equal(clone.Vars()["id"], "2")
+	is.Equal(base.Header.Get("X-Tenant"), "acme")
+	is.Equal(clone.Header.Get("X-Tenant"), "other")
+	is.Equal(len(base.Files()), 1)
+	is.Equal(len(clone.Files()), 2)
+
+	// zero value requests can be cloned
+	clone = (&Request{q: "query {}"}).Clone()
+	is.Equal(clone.Query(), "query {}")
+	clone.Var("id", "3")
+}
+
+type metricsFunc func(op string, dur time.Duration, err error)
+
+func (fn metricsFunc) ObserveRequest(op string, dur time.Duration, err error) {
+	fn(op, dur, err)
+}
+
+func TestMetrics(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			io.WriteString(w, `{"errors":[{"message":"boom"}]}`)
+			return
+		}
+		io.WriteString(w, `{"data":{"value":"some data"}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	var ops []string
+	var errs []error
+	metrics := metricsFunc(func(op string, dur time.Duration, err error) {
+		is.True(dur > 0)
+		ops = append(ops, op)
+		errs = append(errs, err)
+	})
+	client := NewClient(srv.URL, WithMetrics(metrics))
+	is.NoErr(client.Run(ctx, NewRequest("query Items { items }"), nil))
+	is.NoErr(client.Run(ctx, NewRequest("{ items }"), nil))
+	req := NewRequest("query A { a } query B { b }")
+	req.OpName = "B"
+	is.NoErr(client.Run(ctx, req, nil))
+
+	client = NewClient(srv.URL+"?fail=1", WithMetrics(metrics))
+	err := client.Run(ctx, NewRequest("mutation Add { add }"), nil)
+	is.True(err != nil)
+
+	is.Equal(ops, []string{"Items", "anonymous", "B", "Add"})
+	is.NoErr(errs[0])
+	is.Equal(errs[3], err)
+}
+
+func TestMaxResponseBytesEndlessBody(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"value":"`)
+		chunk := strings.Repeat("x", 1024)
+		for r.Context().Err() == nil {
+			if _, err := io.WriteString(w, chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithMaxResponseBytes(1024))
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	var tooLarge *ResponseTooLargeError
+	is.True(errors.As(err, &tooLarge)) // not waiting for the end of the body
+	is.NoErr(ctx.Err())
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, err := io.WriteString(w, `{"data":{"value":"`+strings.Repeat("x", 100)+`"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithMaxResponseBytes(64), WithRetry(3, nil))
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	var tooLarge *ResponseTooLargeError
+	is.True(errors.As(err, &tooLarge))
+	is.Equal(tooLarge.Limit, int64(64))
+	is.Equal(err.Error(), "graphql: response too large: exceeds 64 bytes")
+	is.Equal(calls, 1) // not retried
+
+	client = NewClient(srv.URL, WithMaxResponseBytes(1024))
+	var resp struct{ Value string }
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), &resp))
+	is.Equal(len(resp.Value), 100)
+}
+
+func TestResponseLimits(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			is.Equal(r.Header.Get("Accept-Encoding"), "identity")
+		}
+		// a few KiB expanding to 2 MiB
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		_, err := io.WriteString(zw, `{"data":{"value":"`+strings.Repeat("x", 2<<20)+`"}}`)
+		is.NoErr(err)
+		is.NoErr(zw.Close())
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithResponseLimits(1<<20, true))
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	var tooLarge *ResponseTooLargeError
+	is.True(errors.As(err, &tooLarge))
+	is.Equal(tooLarge.Limit, int64(1<<20))
+
+	client = NewClient(srv.URL, WithResponseLimits(0, false), WithRetry(3, nil))
+	calls = 0
+	err = client.Run(ctx, NewRequest("query {}"), nil)
+	is.True(err != nil)
+	is.Equal(err.Error(), "graphql: gzipped response not allowed")
+	is.Equal(calls, 1) // not retried
+}
+
+func TestGraphQLContentType(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Method, http.MethodPost)
+		is.Equal(r.Header.Get("Content-Type"), "application/graphql; charset=utf-8")
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `query { items { id } }`)
+		_, err = io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, UseGraphQLContentType())
+	var resp struct{ Value string }
+	is.NoErr(client.Run(ctx, NewRequest(`query { items { id } }`), &resp))
+	is.Equal(resp.Value, "some data")
+
+	req := NewRequest(`query ($id: ID) { items(id: $id) { id } }`)
+	req.Var("id", "1")
+	err := client.Run(ctx, req, nil)
+	is.Equal(err.Error(), "cannot send variables with the application/graphql content type")
+	is.Equal(calls, 1)
+}
+
+func TestGraphQLResponseJSON(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("Accept"), "application/graphql-response+json")
+		w.Header().Set("Content-Type", "application/graphql-response+json; charset=utf-8")
+		switch calls {
+		case 1:
+			io.WriteString(w, `{"data":{"value":"some data"}}`)
+		case 2:
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"errors":[{"message":"Cannot query field \"nope\""}]}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"errors":[{"message":"internal"}]}`)
+		}
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, UseGraphQLResponseJSON())
+	var resp struct{ Value string }
+	is.NoErr(client.Run(ctx, NewRequest("query { value }"), &resp))
+	is.Equal(resp.Value, "some data")
+
+	err := client.Run(ctx, NewRequest("query { nope }"), nil)
+	var requestErr *RequestError
+	is.True(errors.As(err, &requestErr))
+	is.Equal(requestErr.StatusCode, http.StatusBadRequest)
+	is.Equal(err.Error(), `graphql: Cannot query field "nope"`)
+	var errs Errors
+	is.True(errors.As(err, &errs))
+
+	err = client.Run(ctx, NewRequest("query { value }"), nil)
+	is.True(!errors.As(err, &requestErr))
+	var statusErr *StatusError
+	is.True(errors.As(err, &statusErr))
+	is.Equal(statusErr.StatusCode, http.StatusInternalServerError)
+	is.Equal(calls, 3)
+}
+
+func TestVarsFromStruct(t *testing.T) {
+	is := is.New(t)
+
+	type input struct {
+		Title    string   `json:"title"`
+		Price    int64    `json:"price"`
+		Tags     []string `json:"tags,omitempty"`
+		Internal string   `json:"-"`
+		Draft    bool
+	}
+	req := NewRequest("mutation ($title: String!, $price: Int!, $id: ID!) {}")
+	req.Var("id", "123")
+	req.Var("title", "old")
+	is.NoErr(req.VarsFromStruct(&input{Title: "Gopher", Price: 9007199254740993, Internal: "secret"}))
+
+	is.Equal(req.Vars()["id"], "123")
+	is.Equal(req.Vars()["title"], "Gopher")
+	is.Equal(req.Vars()["price"], json.Number("9007199254740993"))
+	is.Equal(req.Vars()["Draft"], false)
+	_, ok := req.Vars()["tags"]
+	is.True(!ok)
+	_, ok = req.Vars()["Internal"]
+	is.True(!ok)
+
+	err := req.VarsFromStruct(map[string]interface{}{"a": 1})
+	is.Equal(err.Error(), "graphql: VarsFromStruct needs a struct, got map[string]interface {}")
+	err = req.VarsFromStruct(nil)
+	is.True(err != nil)
+}
+
+func TestCookies(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/"})
+		case 2:
+			session, err := r.Cookie("session")
+			is.NoErr(err)
+			is.Equal(session.Value, "s3cr3t")
+			locale, err := r.Cookie("locale")
+			is.NoErr(err)
+			is.Equal(locale.Value, "en")
+			theme, err := r.Cookie("theme")
+			is.NoErr(err)
+			is.Equal(theme.Value, "dark")
+		}
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	jar, err := cookiejar.New(nil)
+	is.NoErr(err)
+	client := NewClient(srv.URL, WithCookieJar(jar))
+	is.True(http.DefaultClient.Jar == nil) // default client untouched
+
+	is.NoErr(client.Run(ctx, NewRequest("mutation { login }"), nil))
+	req := NewRequest("query { me }")
+	req.AddCookie(&http.Cookie{Name: "locale", Value: "en"})
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(calls, 2)
+}
+
+func TestErrorKinds(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("errors") != "" {
+			io.WriteString(w, `{"errors":[{"message":"boom"}]}`)
+			return
+		}
+		io.WriteString(w, `<html>not json</html>`)
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	var networkErr *NetworkError
+	var decodeErr *DecodeError
+	var errs Errors
+
+	err := NewClient(srv.URL).Run(ctx, NewRequest("query {}"), nil)
+	is.True(errors.As(err, &decodeErr))
+	is.Equal(string(decodeErr.Body), `<html>not json</html>`)
+	is.True(!errors.As(err, &networkErr))
+
+	err = NewClient(srv.URL+"?errors=1").Run(ctx, NewRequest("query {}"), nil)
+	is.True(errors.As(err, &errs))
+	is.True(!errors.As(err, &decodeErr))
+	is.True(!errors.As(err, &networkErr))
+
+	srv.Close()
+	err = NewClient(srv.URL).Run(ctx, NewRequest("query {}"), nil)
+	is.True(errors.As(err, &networkErr))
+	is.True(!errors.As(err, &decodeErr))
+	is.True(strings.HasPrefix(err.Error(), "graphql: network error: "))
+}
+
+func TestEndpointResolver(t *testing.T) {
+	is := is.New(t)
+
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+
+	type tenantKey struct{}
+	client := NewClient(srv.URL+"/default", WithEndpointResolver(func(ctx context.Context, req *Request) (string, error) {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		switch tenant {
+		case "":
+			return "", nil
+		case "unknown":
+			return "", errors.New("no region for tenant")
+		}
+		return srv.URL + "/" + tenant, nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.NoErr(client.Run(context.WithValue(ctx, tenantKey{}, "eu"), NewRequest("query {}"), nil))
+	err := client.Run(context.WithValue(ctx, tenantKey{}, "unknown"), NewRequest("query {}"), nil)
+	is.Equal(err.Error(), "endpoint resolver: no region for tenant")
+	is.Equal(paths, []string{"/default", "/eu"})
+}
+
+func TestHTTP2(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	// a custom TLS configuration disables HTTP/2 unless it is forced
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	meta, err := NewClient(srv.URL, WithHTTPClient(httpClient)).RunWithMeta(ctx, NewRequest("query {}"), nil)
+	is.NoErr(err)
+	is.Equal(meta.Proto, "HTTP/1.1")
+
+	meta, err = NewClient(srv.URL, WithHTTPClient(httpClient), WithHTTP2()).RunWithMeta(ctx, NewRequest("query {}"), nil)
+	is.NoErr(err)
+	is.Equal(meta.Proto, "HTTP/2.0")
+	is.True(!httpClient.Transport.(*http.Transport).ForceAttemptHTTP2) // copied
+}
+
+func TestProxy(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.URL.String(), "http://graphql.example/query") // absolute URL
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer proxy.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	httpClient := &http.Client{Transport: &http.Transport{}}
+	client := NewClient("http://graphql.example/query", WithHTTPClient(httpClient), WithProxy(proxy.URL))
+	is.NoErr(client.Err())
+	var responseData map[string]interface{}
+	err := client.Run(ctx, NewRequest("query {}"), &responseData)
+	is.NoErr(err)
+	is.Equal(calls, 1) // calls
+	is.Equal(responseData["value"], "some data")
+	is.True(httpClient.Transport.(*http.Transport).Proxy == nil) // copied
+}
+
+func TestNewClientE(t *testing.T) {
+	is := is.New(t)
+
+	client, err := NewClientE("https://example.com/graphql")
+	is.NoErr(err)
+	is.True(client != nil)
+
+	_, err = NewClientE("example.com/graphql")
+	is.Equal(err.Error(), `graphql: invalid endpoint "example.com/graphql": scheme must be http or https`)
+	_, err = NewClientE("https:///graphql")
+	is.Equal(err.Error(), `graphql: invalid endpoint "https:///graphql": missing host`)
+	_, err = NewClientE("https://example.com/%zz")
+	is.True(err != nil)
+	_, err = NewClientE("https://example.com/graphql", WithProxy("::"))
+	is.True(err != nil)
+
+	_, err = NewClientE("", WithEndpointResolver(func(ctx context.Context, req *Request) (string, error) {
+		return "https://example.com/graphql", nil
+	}))
+	is.NoErr(err)
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	// the failed handshake is expected
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	httpClient := &http.Client{Transport: &http.Transport{}}
+	err := NewClient(srv.URL, WithHTTPClient(httpClient)).Run(ctx, NewRequest("query {}"), nil)
+	is.True(err != nil) // unknown certificate authority
+
+	var responseData map[string]interface{}
+	err = NewClient(srv.URL, WithHTTPClient(httpClient), WithInsecureSkipVerify()).Run(ctx, NewRequest("query {}"), &responseData)
+	is.NoErr(err)
+	is.Equal(responseData["value"], "some data")
+	tlsConfig := httpClient.Transport.(*http.Transport).TLSClientConfig
+	is.True(tlsConfig == nil || !tlsConfig.InsecureSkipVerify) // copied
+}
+
+func TestProxyInvalid(t *testing.T) {
+	is := is.New(t)
+
+	client := NewClient("http://graphql.example/query", WithProxy("proxy.example:3128"))
+	is.Equal(client.Err().Error(), `graphql: invalid proxy URL "proxy.example:3128": scheme must be http, https or socks5`)
+	client = NewClient("http://graphql.example/query", WithProxy("http://"))
+	is.Equal(client.Err().Error(), `graphql: invalid proxy URL "http://": missing host`)
+
+	err := client.Run(context.Background(), NewRequest("query {}"), nil)
+	is.Equal(err, client.Err())
+}
+
+func TestRunMulti(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, err := io.WriteString(w, `{"data":{"user":{"name":"Mat"},"settings":{"theme":"dark"},"notifications":[{"id":"1"},{"id":"2"}]}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+	var user struct{ Name string }
+	var settings struct{ Theme string }
+	var notifications []struct{ ID string }
+	err := client.RunMulti(ctx, NewRequest("query {}"), map[string]interface{}{
+		"user":          &user,
+		"settings":      &settings,
+		"notifications": &notifications,
+	})
+	is.NoErr(err)
+	is.Equal(user.Name, "Mat")
+	is.Equal(settings.Theme, "dark")
+	is.Equal(len(notifications), 2)
+
+	err = client.RunMulti(ctx, NewRequest("query {}"), map[string]interface{}{"billing": &settings})
+	is.Equal(err.Error(), `graphql: field "billing" not found in response data`)
+	is.Equal(calls, 2)
+}
+
+func TestQueryTransform(t *testing.T) {
+	is := is.New(t)
+
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("query") != "" {
+			queries = append(queries, r.FormValue("query"))
+		} else {
+			var body struct{ Query string }
+			is.NoErr(json.NewDecoder(r.Body).Decode(&body))
+			queries = append(queries, body.Query)
+		}
+		_, err := io.WriteString(w, `{"data":{}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	transform := func(q string) (string, error) {
+		return strings.Replace(q, "name", "name __typename", 1), nil
+	}
+	req := NewRequest("query { name }")
+	is.NoErr(NewClient(srv.URL, WithQueryTransform(transform)).Run(ctx, req, nil))
+	is.NoErr(NewClient(srv.URL, WithQueryTransform(transform), UseMultipartForm()).Run(ctx, req, nil))
+	is.Equal(queries, []string{"query { name __typename }", "query { name __typename }"})
+	is.Equal(req.Query(), "query { name }") // unchanged
+
+	client := NewClient(srv.URL, WithQueryTransform(func(q string) (string, error) {
+		return "", errors.New("bad query")
+	}))
+	err := client.Run(ctx, req, nil)
+	is.Equal(err.Error(), "query transform: bad query")
+	is.Equal(len(queries), 2)
+}
+
+func TestExpectedSchemaVersion(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	version := "2"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Api-Schema", version)
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithExpectedSchemaVersion("2"), WithSchemaVersionHeader("X-Api-Schema"))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+
+	version = "3"
+	var resp struct{ Value string }
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), &resp)) // returned as usual
+	is.Equal(resp.Value, "some data")
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	var mismatch *SchemaVersionError
+	is.True(errors.As(err, &mismatch))
+	is.Equal(mismatch.Expected, "2")
+	is.Equal(mismatch.Actual, "3")
+	is.Equal(calls, 2)
+
+	version = "2"
+	client.ResetSchemaVersion()
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.Equal(calls, 4) // sent again after the reset
+	NewClient(srv.URL).ResetSchemaVersion()
+
+	client = NewClient(srv.URL, WithExpectedSchemaVersion(""), WithSchemaVersionHeader("X-Api-Schema"))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.Equal(calls, 6)
+}
+
+func TestLogRedaction(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("Authorization"), "Bearer secret-token")
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.True(strings.Contains(string(b), "hunter2"))
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	var logs []string
+	client := NewClient(srv.URL, WithBearerToken("secret-token"))
+	client.Log = func(s string) {
+		logs = append(logs, s)
+	}
+	req := NewRequest("mutation ($user: String!, $password: String!) { login }")
+	req.Var("user", "mat")
+	req.Var("password", "hunter2")
+	is.NoErr(client.Run(ctx, req, nil))
+	logged := strings.Join(logs, "\n")
+	is.True(!strings.Contains(logged, "secret-token"))
+	is.True(strings.Contains(logged, "Authorization:[[REDACTED]]"))
+	is.True(strings.Contains(logged, "hunter2"))
+
+	logs = nil
+	client = NewClient(srv.URL, WithBearerToken("secret-token"), WithLogRedaction(func(key string, value interface{}) interface{} {
+		if key == "password" {
+			return "***"
+		}
+		return DefaultLogRedaction(key, value)
+	}))
+	client.Log = func(s string) {
+		logs = append(logs, s)
+	}
+	is.NoErr(client.Run(ctx, req, nil))
+	logged = strings.Join(logs, "\n")
+	is.True(!strings.Contains(logged, "secret-token"))
+	is.True(!strings.Contains(logged, "hunter2"))
+	is.True(strings.Contains(logged, "password:***"))
+	is.True(strings.Contains(logged, "user:mat"))
+}
+
+func TestDataKey(t *testing.T) {
+	is := is.New(t)
+
+	body := `{"payload":{"value":"some data"},"data":{"value":"ignored"}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.WriteString(w, body)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithDataKey("payload"), WithErrorsKey("problems"))
+	var resp struct{ Value string }
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), &resp))
+	is.Equal(resp.Value, "some data")
+
+	body = `{"payload":null,"problems":[{"message":"boom"}]}`
+	err := client.Run(ctx, NewRequest("query {}"), &resp)
+	is.Equal(err.Error(), "graphql: boom")
+
+	raw, err := client.RunRaw(ctx, NewRequest("query {}"))
+	is.Equal(err.Error(), "graphql: boom")
+	is.Equal(string(raw), body) // as sent
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	is := is.New(t)
+
+	body := `{"result":{"payload":{"data":{"value":"some data"}}}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.WriteString(w, body)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithResponseEnvelope("result.payload"))
+	var resp struct{ Value string }
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), &resp))
+	is.Equal(resp.Value, "some data")
+
+	body = `{"result":{"payload":{"data":null,"errors":[{"message":"boom"}]}}}`
+	err := client.Run(ctx, NewRequest("query {}"), &resp)
+	is.Equal(err.Error(), "graphql: boom")
+
+	// errors of the gateway itself
+	body = `{"errors":[{"message":"gateway down"}]}`
+	err = client.Run(ctx, NewRequest("query {}"), &resp)
+	is.Equal(err.Error(), "graphql: gateway down")
+}
+
+func TestRequestMutator(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("X-Signature"), "signed:"+strconv.Itoa(len(`{"query":"query {}","variables":null}`+"\n")))
+		_, err := io.WriteString(w, `{"data":{}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithRequestMutator(func(r *http.Request) error {
+		is.Equal(r.Header.Get("Content-Type"), "application/json; charset=utf-8")
+		body, err := r.GetBody()
+		is.NoErr(err)
+		b, err := ioutil.ReadAll(body)
+		is.NoErr(err)
+		r.Header.Set("X-Signature", "signed:"+strconv.Itoa(len(b)))
+		return nil
+	}))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	r, err := client.Prepare(ctx, NewRequest("query {}"))
+	is.NoErr(err)
+	is.True(r.Header.Get("X-Signature") != "")
+
+	var mutations int
+	client = NewClient(srv.URL, WithRetry(4, nil), WithRequestMutator(func(r *http.Request) error {
+		mutations++
+		return errors.New("no credentials")
+	}))
+	err = client.Run(ctx, NewRequest("query {}"), nil)
+	is.Equal(err.Error(), "request mutator: no credentials")
+	var retryErr *RetryError
+	is.True(!errors.As(err, &retryErr)) // not retried
+	is.Equal(mutations, 1)
+	is.Equal(calls, 1)
+}
+
+func TestRunRawData(t *testing.T) {
+	is := is.New(t)
+
+	body := `{"data":{"node":{"__typename":"User","name":"Mat"}}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(body, "unavailable") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, err := io.WriteString(w, body)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+	data, errs, err := client.RunRawData(ctx, NewRequest("query {}"))
+	is.NoErr(err)
+	is.Equal(len(errs), 0)
+	is.Equal(string(data), `{"node":{"__typename":"User","name":"Mat"}}`)
+
+	body = `{"data":{"node":null},"errors":[{"message":"not found","path":["node"]}]}`
+	data, errs, err = client.RunRawData(ctx, NewRequest("query {}"))
+	is.NoErr(err)
+	is.Equal(errs[0].Message, "not found")
+	is.Equal(string(data), `{"node":null}`)
+
+	body = `{"data":null,"errors":[{"message":"boom"}]}`
+	data, errs, err = client.RunRawData(ctx, NewRequest("query {}"))
+	is.NoErr(err)
+	is.Equal(errs[0].Message, "boom")
+	is.Equal(data, nil)
+
+	body = `{"errors":[{"message":"unavailable"}]}`
+	_, _, err = client.RunRawData(ctx, NewRequest("query {}"))
+	var statusErr *StatusError
+	is.True(errors.As(err, &statusErr))
+}
+
+func TestBaseVariables(t *testing.T) {
+	is := is.New(t)
+
+	var variables []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Variables map[string]interface{} }
+		is.NoErr(json.NewDecoder(r.Body).Decode(&body))
+		variables = append(variables, body.Variables)
+		_, err := io.WriteString(w, `{"data":{}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithBaseVariables(map[string]interface{}{
+		"tenantId": "acme",
+		"locale":   "en",
+	}), WithLocalVariableCheck())
+	req := NewRequest("query ($tenantId: ID!, $locale: String!, $id: ID!) { node(id: $id) { id } }")
+	req.Var("id", "1")
+	req.Var("locale", "fr")
+	is.NoErr(client.Run(ctx, req, nil))
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.Equal(variables, []map[string]interface{}{
+		{"tenantId": "acme", "locale": "fr", "id": "1"},
+		{"tenantId": "acme", "locale": "en"},
+	})
+	is.Equal(req.Vars(), map[string]interface{}{"id": "1", "locale": "fr"}) // unchanged
+}
+
+func TestErrorRaw(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":null,"errors":[{"message":"boom","errorId":"e-42","retryable":true}]}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	err := NewClient(srv.URL).Run(ctx, NewRequest("query {}"), nil)
+	var errs Errors
+	is.True(errors.As(err, &errs))
+	is.Equal(len(errs), 1)
+	is.Equal(string(errs[0].Raw), `{"message":"boom","errorId":"e-42","retryable":true}`)
+	var custom struct {
+		ErrorID   string `json:"errorId"`
+		Retryable bool   `json:"retryable"`
+	}
+	is.NoErr(errs[0].DecodeRaw(&custom))
+	is.Equal(custom.ErrorID, "e-42")
+	is.True(custom.Retryable)
+
+	is.True(Error{Message: "boom"}.DecodeRaw(&custom) != nil) // no raw object
+}
+
+func TestOperationNameHeader(t *testing.T) {
+	is := is.New(t)
+
+	var names []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names = append(names, r.Header.Get("X-GraphQL-Operation"))
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithOperationNameHeader(""))
+
+	err := client.Run(ctx, NewRequest("query Hero($episode: Episode) { hero { name } }"), nil)
+	is.NoErr(err)
+	req := NewRequest("query A { a } query B { b }")
+	req.OpName = "B"
+	err = client.Run(ctx, req, nil)
+	is.NoErr(err)
+	err = client.Run(ctx, NewRequest("{ anonymous }"), nil)
+	is.NoErr(err)
+	req = NewRequest("query Hero { hero { name } }")
+	req.Header.Set("X-GraphQL-Operation", "Override")
+	err = client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(names, []string{"Hero", "B", "", "Override"})
+}
+
+func TestEmptyResponse(t *testing.T) {
+	is := is.New(t)
+
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	responseData := map[string]interface{}{"untouched": true}
+	err := client.Run(ctx, NewRequest("mutation { something }"), &responseData)
+	is.NoErr(err)
+	is.Equal(responseData, map[string]interface{}{"untouched": true})
+
+	status = http.StatusOK
+	err = client.Run(ctx, NewRequest("mutation { something }"), &responseData)
+	is.NoErr(err)
+	is.Equal(responseData, map[string]interface{}{"untouched": true})
+
+	status = http.StatusInternalServerError
+	err = client.Run(ctx, NewRequest("mutation { something }"), &responseData)
+	is.True(err != nil)
+}
+
+func TestPing(t *testing.T) {
+	is := is.New(t)
+
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `{"query":"{ __typename }","variables":null}`+"\n")
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			io.WriteString(w, "Service Unavailable")
+			return
+		}
+		io.WriteString(w, `{"data":{"__typename":"Query"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	is.NoErr(client.Ping(ctx))
+	status = http.StatusServiceUnavailable
+	is.True(client.Ping(ctx) != nil)
+}
+
+func TestPingWithoutCache(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	down := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("If-None-Match"), "")
+		is.Equal(r.Header.Get("Cache-Control"), "no-cache")
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "Service Unavailable")
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, `{"data":{"__typename":"Query"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithResponseCache(time.Minute, 10), UseGETForQueries(), WithETags(10))
+
+	is.NoErr(client.Ping(ctx))
+	is.NoErr(client.Ping(ctx))
+	is.Equal(calls, 2) // always sent
+	down = true
+	is.True(client.Ping(ctx) != nil)
+	is.Equal(calls, 3)
+}
+
+func TestRequestHeaderReplacesDefaults(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header["Accept"], []string{"application/json"})
+		is.Equal(r.Header["Content-Type"], []string{"application/json"})
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	req := NewRequest("query {}")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	is.NoErr(client.Run(ctx, req, nil))
+}
+
+func TestRawVariables(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `{"query":"query {}","variables":{"z":1,"id":9007199254740993}}`+"\n")
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	req := NewRequest("query {}")
+	req.SetRawVariables(json.RawMessage(`{"z": 1, "id": 9007199254740993}`))
+	var responseData map[string]interface{}
+	is.NoErr(client.Run(ctx, req, &responseData))
+	is.Equal(calls, 1) // calls
+	is.Equal(responseData["something"], "yes")
+
+	req.Var("other", true)
+	err := client.Run(ctx, req, &responseData)
+	is.True(err != nil)
+	is.Equal(err.Error(), "graphql: request has both raw variables and variables set with Var")
+	is.Equal(calls, 1) // not sent
+
+	req = NewRequest("query {}")
+	req.SetRawVariables(json.RawMessage(`[1]`))
+	err = client.Run(ctx, req, &responseData)
+	is.True(err != nil)
+	is.Equal(calls, 1) // invalid variables not sent
+}
+
+func TestLoggerRequestID(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	var logs, logged []string
+	var ids []string
+	client := NewClient(srv.URL, WithLogger(func(ctx context.Context, s string) {
+		ids = append(ids, RequestID(ctx))
+		logged = append(logged, s)
+	}))
+	client.Log = func(s string) {
+		logs = append(logs, s)
+	}
+
+	is.NoErr(client.Run(ContextWithRequestID(ctx, "req-1"), NewRequest("query {}"), nil))
+	is.True(len(logs) > 0)
+	is.Equal(len(logged), len(logs))
+	for i, s := range logs {
+		is.Equal(ids[i], "req-1")
+		is.Equal(s, "[req-1] "+logged[i])
+	}
+
+	ids = nil
+	is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	is.True(ids[0] != "")
+	is.True(ids[0] != "req-1")
+	for _, id := range ids {
+		is.Equal(id, ids[0]) // same ID for the whole request
+	}
+}
+
+func TestVarOrdered(t *testing.T) {
+	is := is.New(t)
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		bodies = append(bodies, string(b))
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithBaseVariables(map[string]interface{}{"locale": "en"}))
+
+	req := NewRequest("query {}")
+	req.VarOrdered("z", 1)
+	req.VarOrdered("b", "two")
+	req.Var("a", true)
+	req.VarOrdered("z", 3)
+	is.NoErr(client.Run(ctx, req, nil))
+	is.NoErr(client.Run(ctx, req.Clone(), nil))
+	is.Equal(len(bodies), 2)
+	is.Equal(bodies[0], `{"query":"query {}","variables":{"z":3,"b":"two","a":true,"locale":"en"}}`+"\n")
+	is.Equal(bodies[1], bodies[0])
+}
@@ -0,0 +1,70 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestMiddleware(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("X-Injected"), "yes")
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next RunFunc) RunFunc {
+			return func(ctx context.Context, req *Request, resp interface{}) error {
+				order = append(order, name+" before")
+				err := next(ctx, req, resp)
+				order = append(order, name+" after")
+				return err
+			}
+		}
+	}
+	inject := func(next RunFunc) RunFunc {
+		return func(ctx context.Context, req *Request, resp interface{}) error {
+			req.Header.Set("X-Injected", "yes")
+			return next(ctx, req, resp)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithMiddleware(trace("outer")), WithMiddleware(trace("inner")), WithMiddleware(inject))
+
+	var responseData map[string]interface{}
+	meta, err := client.RunWithMeta(ctx, NewRequest("query {}"), &responseData)
+	is.NoErr(err)
+	is.Equal(calls, 1) // calls
+	is.Equal(responseData["something"], "yes")
+	is.Equal(meta.StatusCode, http.StatusOK)
+	is.Equal(order, []string{"outer before", "inner before", "inner after", "outer after"})
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	is := is.New(t)
+	cache := func(next RunFunc) RunFunc {
+		return func(ctx context.Context, req *Request, resp interface{}) error {
+			*resp.(*map[string]interface{}) = map[string]interface{}{"something": "cached"}
+			return nil
+		}
+	}
+
+	client := NewClient("http://localhost:0", WithMiddleware(cache))
+
+	var responseData map[string]interface{}
+	err := client.Run(context.Background(), NewRequest("query {}"), &responseData)
+	is.NoErr(err)
+	is.Equal(responseData["something"], "cached")
+}
@@ -41,3 +41,80 @@ func TestFillMultipartRequestSpecNoFiles(t *testing.T) {
 	is.NoErr(e)
 	is.Equal(`{}`, string(maps))
 }
+
+func TestFillMultipartRequestSpecOperationName(t *testing.T) {
+	is := is.New(t)
+
+	req := NewRequest("query A {} query B {}")
+	req.OpName = "B"
+	req.File("file", "filename.txt", strings.NewReader(`This is a file`))
+
+	mprs := req.fillMultipartRequestSpecQuery()
+
+	operations, e := json.Marshal(mprs.Operations)
+	is.NoErr(e)
+	is.Equal(`{"query":"query A {} query B {}","variables":{"file":null},"operationName":"B"}`, string(operations))
+}
+
+func TestFillMultipartRequestSpecVariables(t *testing.T) {
+	is := is.New(t)
+
+	req := NewRequest("mutation ($userId: ID!, $files: [Upload!]!) {}")
+	req.Var("userId", "123")
+	req.Var("files", []string{"placeholder"})
+	f := strings.NewReader(`This is a file`)
+	req.File("file1", "filename1.txt", f)
+	req.File("file2", "filename2.txt", f)
+
+	mprs := req.fillMultipartRequestSpecQuery()
+
+	operations, e := json.Marshal(mprs.Operations)
+	is.NoErr(e)
+	is.Equal(`{"query":"mutation ($userId: ID!, $files: [Upload!]!) {}","variables":{"files":[null,null],"userId":"123"}}`, string(operations))
+}
+
+func TestFillMultipartRequestSpecFileList(t *testing.T) {
+	is := is.New(t)
+
+	req := NewRequest("mutation ($avatar: Upload!, $gallery: [Upload!]!) {}")
+	f := strings.NewReader(`This is a file`)
+	req.File("avatar", "avatar.png", f)
+	req.FileList("gallery",
+		File{Name: "photo1.png", R: f},
+		File{Name: "photo2.png", R: f},
+	)
+	req.FileList("gallery", File{Field: "third", Name: "photo3.png", R: f})
+
+	is.Equal(req.Files()[1].Field, "gallery.0")
+	is.Equal(req.Files()[2].Field, "gallery.1")
+
+	mprs := req.fillMultipartRequestSpecQuery()
+
+	operations, e := json.Marshal(mprs.Operations)
+	is.NoErr(e)
+	is.Equal(`{"query":"mutation ($avatar: Upload!, $gallery: [Upload!]!) {}","variables":{"avatar":null,"gallery":[null,null,null]}}`, string(operations))
+
+	maps, e := json.Marshal(mprs.Map)
+	is.NoErr(e)
+	is.Equal(`{"avatar":["variables.avatar"],"gallery.0":["variables.gallery.0"],"gallery.1":["variables.gallery.1"],"third":["variables.gallery.2"]}`, string(maps))
+}
+
+func TestFillMultipartRequestSpecDeclaredVariables(t *testing.T) {
+	is := is.New(t)
+
+	req := NewRequest("mutation ($avatar: Upload!, $cover: Upload) {}")
+	f := strings.NewReader(`This is a file`)
+	req.File("avatar", "avatar.png", f)
+	req.File("cover", "cover.png", f)
+	req.File("other", "other.png", f)
+
+	mprs := req.fillMultipartRequestSpecQuery()
+
+	operations, e := json.Marshal(mprs.Operations)
+	is.NoErr(e)
+	is.Equal(`{"query":"mutation ($avatar: Upload!, $cover: Upload) {}","variables":{"avatar":null,"cover":null,"file":null}}`, string(operations))
+
+	maps, e := json.Marshal(mprs.Map)
+	is.NoErr(e)
+	is.Equal(`{"avatar":["variables.avatar"],"cover":["variables.cover"],"other":["variables.file"]}`, string(maps))
+}
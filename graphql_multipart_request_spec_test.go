@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/matryer/is"
-	"github.com/stretchr/testify/assert"
 )
 
 func TestWithClientMpRS(t *testing.T) {
@@ -219,9 +218,10 @@ func TestQueryMpRS(t *testing.T) {
 	var calls int
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		calls++
-		query := r.FormValue("query")
-		is.Equal(query, "query {}")
-		is.Equal(r.FormValue("variables"), `{"username":"matryer"}`+"\n")
+		operations := r.FormValue("operations")
+		is.Equal(operations, `{"query":"query {}","variables":{"file":null,"username":"matryer"}}`)
+		maps := r.FormValue("map")
+		is.Equal(maps, `{"file":["variables.file"]}`)
 		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
 		is.NoErr(err)
 	}))
@@ -244,7 +244,9 @@ func TestQueryMpRS(t *testing.T) {
 		Value string
 	}
 	err := client.Run(ctx, req, &resp)
-	assert.Error(t, err, "variables doesn't supported due to the multipart request spec")
+	is.NoErr(err)
+	is.Equal(calls, 1)
+	is.Equal(resp.Value, "some data")
 }
 
 func TestFileMpRS(t *testing.T) {
@@ -282,6 +284,105 @@ func TestFileMpRS(t *testing.T) {
 	is.NoErr(err)
 }
 
+func TestDuplicateFileFieldMpRS(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartRequestSpec())
+
+	req := NewRequest("mutation {}")
+	req.File("file", "a.txt", strings.NewReader(`a`))
+	req.File("file", "b.txt", strings.NewReader(`b`))
+	err := client.Run(ctx, req, nil)
+	is.Equal(err.Error(), `graphql: several files have the field "file"`)
+	is.Equal(calls, 0) // not sent
+}
+
+func TestLocalVariableCheckMpRS(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.FormValue("map"), `{"avatar":["variables.avatar"],"photos.0":["variables.photos.0"]}`)
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartRequestSpec(), WithLocalVariableCheck())
+
+	req := NewRequest("mutation ($avatar: Upload!, $photos: [Upload!]!) { a }")
+	req.File("avatar", "avatar.png", strings.NewReader(`avatar`))
+	req.FileList("photos", File{Name: "a.png", R: strings.NewReader(`a`)})
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(calls, 1) // calls
+
+	req = NewRequest("mutation ($avatar: Upload!, $photos: [Upload!]!) { a }")
+	req.File("avatar", "avatar.png", strings.NewReader(`avatar`))
+	err := client.Run(ctx, req, nil)
+	is.Equal(err.Error(), "graphql: missing value for variable $photos of type [Upload!]!")
+	is.Equal(calls, 1) // not sent
+}
+
+func TestFileWithTypeMpRS(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		file, header, err := r.FormFile("avatar")
+		is.NoErr(err)
+		defer file.Close()
+		is.Equal(header.Filename, "avatar.png")
+		is.Equal(header.Header.Get("Content-Type"), "image/png")
+
+		_, err = io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartRequestSpec())
+	req := NewRequest("query {}")
+	req.FileWithType("avatar", "avatar.png", "image/png", strings.NewReader(`PNG`))
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(calls, 1)
+}
+
+func TestMultipartFieldNamesMpRS(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.FormValue("ops"), `{"query":"query {}","variables":{"file":null}}`)
+		is.Equal(r.FormValue("files"), `{"file":["variables.file"]}`)
+		is.Equal(r.FormValue("operations"), "")
+		is.Equal(r.FormValue("map"), "")
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartRequestSpec(), WithMultipartFieldNames("ops", "files"))
+	req := NewRequest("query {}")
+	req.File("file", "filename.txt", strings.NewReader(`This is a file`))
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(calls, 1)
+}
+
 type roundTripperFuncMpRS func(req *http.Request) (*http.Response, error)
 
 func (fn roundTripperFuncMpRS) RoundTrip(req *http.Request) (*http.Response, error) {
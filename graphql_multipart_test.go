@@ -6,11 +6,14 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/matryer/is"
+	"github.com/pkg/errors"
 )
 
 func TestWithClient(t *testing.T) {
@@ -199,8 +202,11 @@ func TestDoBadRequestErrDetails(t *testing.T) {
 	defer cancel()
 	var responseData map[string]interface{}
 	err := client.Run(ctx, &Request{q: "query {}"}, &responseData)
-	errs, ok := err.(Errors)
-	is.True(ok)
+	var statusErr *StatusError
+	is.True(errors.As(err, &statusErr))
+	is.Equal(statusErr.StatusCode, http.StatusBadRequest)
+	var errs Errors
+	is.True(errors.As(err, &errs))
 	is.Equal(len(errs), 1)
 	e := errs[0]
 	is.Equal(e.Message, "Name for character with ID 1002 could not be fetched.")
@@ -303,8 +309,336 @@ func TestFile(t *testing.T) {
 	is.NoErr(err)
 }
 
+func TestOperationName(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.FormValue("query"), "query A {} query B {}")
+		is.Equal(r.FormValue("operationName"), "B")
+		_, err := io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, UseMultipartForm())
+
+	req := NewRequest("query A {} query B {}")
+	req.OpName = "B"
+
+	var resp struct {
+		Value string
+	}
+	err := client.Run(ctx, req, &resp)
+	is.NoErr(err)
+	is.Equal(calls, 1)
+	is.Equal(resp.Value, "some data")
+}
+
+func TestFileWithType(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		file, header, err := r.FormFile("avatar")
+		is.NoErr(err)
+		defer file.Close()
+		is.Equal(header.Filename, "avatar.png")
+		is.Equal(header.Header.Get("Content-Type"), "image/png")
+
+		file, header, err = r.FormFile("file")
+		is.NoErr(err)
+		defer file.Close()
+		is.Equal(header.Header.Get("Content-Type"), "application/octet-stream")
+
+		_, err = io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartForm())
+	req := NewRequest("query {}")
+	req.FileWithType("avatar", "avatar.png", "image/png", strings.NewReader(`PNG`))
+	req.File("file", "filename.txt", strings.NewReader(`This is a file`))
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(calls, 1)
+}
+
 type roundTripperFunc func(req *http.Request) (*http.Response, error)
 
 func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 	return fn(req)
 }
+
+func TestFileFromPath(t *testing.T) {
+	is := is.New(t)
+
+	dir, err := ioutil.TempDir("", "graphql")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.txt")
+	is.NoErr(ioutil.WriteFile(path, []byte(`This is a file`), 0600))
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		file, header, err := r.FormFile("report")
+		is.NoErr(err)
+		defer file.Close()
+		is.Equal(header.Filename, "report.txt")
+		b, err := ioutil.ReadAll(file)
+		is.NoErr(err)
+		is.Equal(string(b), `This is a file`)
+		_, err = io.WriteString(w, `{"data":{"value":"some data"}}`)
+		is.NoErr(err)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartForm())
+	req := NewRequest("query {}")
+	is.NoErr(req.FileFromPath("report", path))
+	err = client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(calls, 1)
+
+	// the file is closed after the request
+	_, err = req.Files()[0].R.Read(make([]byte, 1))
+	is.True(errors.Is(err, os.ErrClosed))
+
+	err = req.FileFromPath("missing", filepath.Join(dir, "missing.txt"))
+	is.True(os.IsNotExist(errors.Cause(err)))
+}
+
+// cancellingReader cancels the request when it is first read.
+type cancellingReader struct {
+	cancel func()
+	closed bool
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return copy(p, "partial"), nil
+}
+
+func (r *cancellingReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestFileUploadCancelled(t *testing.T) {
+	is := is.New(t)
+
+	// uploads are streamed, so the server sees the start of the request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer srv.Close()
+
+	for _, opt := range []ClientOption{UseMultipartForm(), UseMultipartRequestSpec()} {
+		ctx, cancel := context.WithCancel(context.Background())
+		client := NewClient(srv.URL, opt)
+		r := &cancellingReader{cancel: cancel}
+		other := &cancellingReader{cancel: cancel}
+		req := NewRequest("mutation {}")
+		req.File("file", "big.bin", r)
+		req.File("other", "other.bin", other)
+		err := client.Run(ctx, req, nil)
+		var canceled *CanceledError
+		is.True(errors.As(err, &canceled))
+		is.Equal(canceled.Err, context.Canceled)
+		is.True(r.closed)
+		is.True(other.closed)
+	}
+}
+
+// blockingReader returns first, then waits for release before
+// returning the rest.
+type blockingReader struct {
+	first, rest string
+	release     chan struct{}
+	step        int
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	r.step++
+	switch r.step {
+	case 1:
+		return copy(p, r.first), nil
+	case 2:
+		select {
+		case <-r.release:
+		case <-time.After(1 * time.Second):
+			return 0, errors.New("upload was buffered")
+		}
+		return copy(p, r.rest), nil
+	}
+	return 0, io.EOF
+}
+
+func TestFileUploadStreamed(t *testing.T) {
+	is := is.New(t)
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.ContentLength, int64(-1))
+		mr, err := r.MultipartReader()
+		is.NoErr(err)
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			is.NoErr(err)
+			if part.FormName() != "file" {
+				continue
+			}
+			buf := make([]byte, 5)
+			_, err = io.ReadFull(part, buf)
+			is.NoErr(err)
+			is.Equal(string(buf), "first")
+			close(release)
+			rest, err := ioutil.ReadAll(part)
+			is.NoErr(err)
+			is.Equal(string(rest), " and the rest")
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, UseMultipartForm())
+	req := NewRequest("mutation {}")
+	req.File("file", "big.bin", &blockingReader{first: "first", rest: " and the rest", release: release})
+	is.NoErr(client.Run(ctx, req, nil))
+}
+
+func TestFileUploadContentLength(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(r.ContentLength, int64(len(b)))
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "graphql")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file.txt")
+	is.NoErr(ioutil.WriteFile(path, []byte("file content"), 0600))
+	for _, opt := range []ClientOption{UseMultipartForm(), UseMultipartRequestSpec()} {
+		client := NewClient(srv.URL, opt)
+		req := NewRequest("mutation ($file: Upload!) { upload(file: $file) }")
+		req.Var("id", 1)
+		req.File("file", "a.txt", strings.NewReader("some content"))
+		is.NoErr(req.FileFromPath("other", path))
+		is.NoErr(client.Run(ctx, req, nil))
+	}
+}
+
+func TestFileUploadMode(t *testing.T) {
+	is := is.New(t)
+
+	var contentTypes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.NoErr(r.ParseMultipartForm(1 << 20))
+		if r.FormValue("operations") != "" {
+			contentTypes = append(contentTypes, "spec")
+		} else {
+			contentTypes = append(contentTypes, "form")
+		}
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	for _, opts := range [][]ClientOption{
+		{WithFileUploadMode(FileUploadForm)},
+		{WithFileUploadMode(FileUploadSpec)},
+		{UseMultipartForm(), UseMultipartRequestSpec()},
+		{UseMultipartRequestSpec(), UseMultipartForm()},
+	} {
+		req := NewRequest("mutation {}")
+		req.File("file", "a.txt", strings.NewReader("content"))
+		is.NoErr(NewClient(srv.URL, opts...).Run(ctx, req, nil))
+	}
+	is.Equal(contentTypes, []string{"form", "spec", "spec", "form"})
+
+	req := NewRequest("mutation {}")
+	req.File("file", "a.txt", strings.NewReader("content"))
+	err := NewClient(srv.URL, UseMultipartForm(), WithFileUploadMode(FileUploadNone)).Run(ctx, req, nil)
+	is.Equal(err.Error(), "cannot send files with PostFields option")
+}
+
+func TestFileReaderConsumed(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.Copy(ioutil.Discard, r.Body)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, UseMultipartForm())
+	req := NewRequest("mutation {}")
+	req.File("file", "a.txt", strings.NewReader("content"))
+	is.NoErr(client.Run(ctx, req, nil))
+	err := client.Run(ctx, req, nil)
+	is.Equal(err.Error(), `graphql: reader of file "a.txt" already consumed; create a fresh Request`)
+	is.Equal(calls, 1)
+
+	// clones and requests made from the files of req share their readers
+	req = NewRequest("mutation {}")
+	req.File("file", "b.txt", strings.NewReader("content"))
+	clone := req.Clone()
+	other := NewRequest("mutation {}")
+	other.FileList("files", req.Files()...)
+	is.NoErr(client.Run(ctx, req, nil))
+	err = client.Run(ctx, clone, nil)
+	is.Equal(err.Error(), `graphql: reader of file "b.txt" already consumed; create a fresh Request`)
+	err = client.Run(ctx, other, nil)
+	is.Equal(err.Error(), `graphql: reader of file "b.txt" already consumed; create a fresh Request`)
+	is.Equal(calls, 2)
+}
+
+func TestMultipartBoundary(t *testing.T) {
+	is := is.New(t)
+
+	client := NewClient("https://example.com/graphql", UseMultipartForm(), WithMultipartBoundary("golden"))
+	is.NoErr(client.Err())
+	req := NewRequest("mutation {}")
+	req.File("file", "filename.txt", strings.NewReader(`This is a file`))
+	r, err := client.Prepare(context.Background(), req)
+	is.NoErr(err)
+	is.Equal(r.Header.Get("Content-Type"), "multipart/form-data; boundary=golden")
+	b, err := ioutil.ReadAll(r.Body)
+	is.NoErr(err)
+	is.Equal(string(b), "--golden\r\n"+
+		"Content-Disposition: form-data; name=\"query\"\r\n\r\n"+
+		"mutation {}\r\n"+
+		"--golden\r\n"+
+		"Content-Disposition: form-data; name=\"file\"; filename=\"filename.txt\"\r\n"+
+		"Content-Type: application/octet-stream\r\n\r\n"+
+		"This is a file\r\n"+
+		"--golden--\r\n")
+
+	client = NewClient("https://example.com/graphql", WithMultipartBoundary("not valid!"))
+	is.True(client.Err() != nil)
+}
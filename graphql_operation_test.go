@@ -0,0 +1,105 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestParseOperations(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(parseOperations(`{ items { id } }`), []operation{{typ: "query"}})
+	is.Equal(parseOperations(`query { items }`), []operation{{typ: "query"}})
+	is.Equal(parseOperations(`query Items($key: String! = "{", $in: In = {a: 1}) @live { items(id: $key) { id } }`),
+		[]operation{{typ: "query", name: "Items", variables: `$key: String! = "{", $in: In = {a: 1}`}})
+	is.Equal(parseOperations(`
+		# mutation Commented { x }
+		fragment F on Item { id query }
+		mutation Add { add(text: "query Fake { }") { ...F } }
+		subscription OnAdd @live { added { id } }
+	`), []operation{{typ: "mutation", name: "Add"}, {typ: "subscription", name: "OnAdd"}})
+	is.Equal(parseOperations(`query Q { a(s: """ block " { """) }`), []operation{{typ: "query", name: "Q"}})
+	is.Equal(len(parseOperations(``)), 0)
+}
+
+func TestOperationType(t *testing.T) {
+	is := is.New(t)
+
+	req := NewRequest(`query A { a } mutation B { b }`)
+	is.Equal(req.operationType(), "query")
+	req.OpName = "B"
+	is.Equal(req.operationType(), "mutation")
+	req.OpName = "C"
+	is.Equal(req.operationType(), "")
+}
+
+func TestParseVariables(t *testing.T) {
+	is := is.New(t)
+
+	ops := parseOperations(`query Q($id: ID!, $first: Int! = 10 @deprecated(reason: "$x"), $tags: [String!]!, $after: String) @live { a }`)
+	is.Equal(len(ops), 1)
+	is.Equal(parseVariables(ops[0].variables), []variable{
+		{name: "id", typ: "ID!"},
+		{name: "first", typ: "Int!", hasDefault: true},
+		{name: "tags", typ: "[String!]!"},
+		{name: "after", typ: "String"},
+	})
+	is.Equal(len(parseVariables("")), 0)
+}
+
+func TestCheckVariables(t *testing.T) {
+	is := is.New(t)
+
+	req := NewRequest(`query Q($id: ID!, $first: Int! = 10, $after: String) { a } mutation M($text: String!) { b }`)
+	err := req.checkVariables(nil)
+	is.Equal(err.Error(), "graphql: missing value for variable $id of type ID!")
+	req.Var("id", "123")
+	is.NoErr(req.checkVariables(nil))
+
+	req.OpName = "M"
+	err = req.checkVariables(nil)
+	is.Equal(err.Error(), "graphql: missing value for variable $text of type String!")
+	req.Var("text", "hello")
+	is.NoErr(req.checkVariables(nil))
+
+	req = NewRequest(`mutation ($avatar: Upload!) { a }`)
+	err = req.checkVariables(nil)
+	is.Equal(err.Error(), "graphql: missing value for variable $avatar of type Upload!")
+	is.NoErr(req.checkVariables(map[string]bool{"avatar": true}))
+}
+
+func TestRequestOperationName(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(NewRequest(`# comment
+query Hero($episode: Episode) { hero(episode: $episode) { name } }`).OperationName(), "Hero")
+	is.Equal(NewRequest(`mutation AddReview { addReview { id } }`).OperationName(), "AddReview")
+	is.Equal(NewRequest(`fragment F on User { name } subscription OnReview { review { id } }`).OperationName(), "OnReview")
+	is.Equal(NewRequest(`query { hero { name } }`).OperationName(), "")
+	is.Equal(NewRequest(`{ hero { name } }`).OperationName(), "")
+
+	req := NewRequest(`query A { a } query B { b }`)
+	is.Equal(req.OperationName(), "A")
+	req.OpName = "B"
+	is.Equal(req.OperationName(), "B")
+}
+
+func TestAddFragment(t *testing.T) {
+	is := is.New(t)
+
+	req := NewRequest("query { hero { ...HeroFields } villain { ...VillainFields } }")
+	is.NoErr(req.AddFragment("HeroFields", "on Character { name }"))
+	is.NoErr(req.AddFragment("VillainFields", "on Character { name lair }"))
+	is.NoErr(req.AddFragment("HeroFields", " on Character { name }\n"))
+	err := req.AddFragment("HeroFields", "on Character { id }")
+	is.Equal(err.Error(), "graphql: fragment HeroFields is already defined with another body")
+	is.Equal(req.Query(), "query { hero { ...HeroFields } villain { ...VillainFields } }\n\n"+
+		"fragment HeroFields on Character { name }\n\n"+
+		"fragment VillainFields on Character { name lair }")
+
+	clone := req.Clone()
+	is.NoErr(clone.AddFragment("HeroFields", "on Character { name }"))
+	is.Equal(clone.Query(), req.Query())
+	is.Equal(len(parseOperations(req.Query())), 1) // fragments are not operations
+}
@@ -0,0 +1,150 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestPersistedQueries(t *testing.T) {
+	is := is.New(t)
+	registered := map[string]bool{}
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		switch string(b) {
+		case `{"variables":null,"extensions":{"persistedQuery":{"sha256Hash":"` + queryHash("query {}") + `","version":1}}}` + "\n":
+			if !registered["query {}"] {
+				io.WriteString(w, `{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`)
+				return
+			}
+		case `{"query":"query {}","variables":null,"extensions":{"persistedQuery":{"sha256Hash":"` + queryHash("query {}") + `","version":1}}}` + "\n":
+			registered["query {}"] = true
+		default:
+			t.Fatalf("unexpected body: %s", b)
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithPersistedQueries())
+
+	req := NewRequest("query {}")
+	var responseData map[string]interface{}
+	err := client.Run(ctx, req, &responseData)
+	is.NoErr(err)
+	is.Equal(calls, 2) // calls
+	is.Equal(responseData["something"], "yes")
+
+	err = client.Run(ctx, req, &responseData)
+	is.NoErr(err)
+	is.Equal(calls, 3) // calls
+	is.True(req.omitQuery == false)
+}
+
+func TestPersistedQueriesGET(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Method, http.MethodGet)
+		is.Equal(r.URL.Query().Get("query"), "")
+		is.Equal(r.URL.Query().Get("extensions"), `{"persistedQuery":{"sha256Hash":"`+queryHash("query {}")+`","version":1}}`)
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithPersistedQueries(), UseGETForQueries())
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.NoErr(err)
+	is.Equal(calls, 1) // calls
+}
+
+func TestQueryHash(t *testing.T) {
+	is := is.New(t)
+	req := NewRequest("query {}")
+	is.Equal(req.queryHash(), "7fb544f193f14b5ab2727c24b32bb7eecae2c307fcd1cd9f0c7222c2ddd562b8")
+	is.Equal(req.hashedQuery, "query {}")
+}
+
+func queryHash(q string) string {
+	return NewRequest(q).queryHash()
+}
+
+func TestDocumentID(t *testing.T) {
+	is := is.New(t)
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		bodies = append(bodies, string(b))
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithPersistedQueries())
+
+	req := NewRequest("")
+	req.SetDocumentID("abc123")
+	req.Var("id", "1")
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(bodies, []string{`{"documentId":"abc123","variables":{"id":"1"}}` + "\n"})
+}
+
+func TestTrustedDocuments(t *testing.T) {
+	is := is.New(t)
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		bodies = append(bodies, string(b))
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithTrustedDocuments(map[string]string{
+		"hero": "query Hero { hero { name } }",
+	}), WithOperationNameHeader(""))
+
+	req := NewRequest("query Hero { hero { name } }")
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(req.DocumentID(), "") // restored
+
+	req = NewRequest("")
+	req.SetDocumentID("hero")
+	err = client.Run(ctx, req, nil)
+	is.NoErr(err)
+	is.Equal(req.Query(), "") // restored
+	is.Equal(bodies, []string{
+		`{"documentId":"hero","variables":null}` + "\n",
+		`{"documentId":"hero","variables":null}` + "\n",
+	})
+
+	err = client.Run(ctx, NewRequest("query Villain { villain { name } }"), nil)
+	is.Equal(err.Error(), "graphql: query is not a trusted document")
+
+	req = NewRequest("query Villain { villain { name } }")
+	req.SetDocumentID("hero")
+	err = client.Run(ctx, req, nil)
+	is.Equal(err.Error(), `graphql: query doesn't match trusted document "hero"`)
+	is.Equal(len(bodies), 2) // not sent
+}
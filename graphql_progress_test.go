@@ -0,0 +1,131 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestProgress(t *testing.T) {
+	is := is.New(t)
+
+	var contentLength int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		_, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	var reports [][2]int64
+	client := NewClient(srv.URL, UseMultipartForm(), WithProgress(func(sent, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, [2]int64{sent, total})
+	}))
+
+	req := NewRequest("mutation {}")
+	req.File("file", "filename.txt", bytes.NewReader(make([]byte, 1<<20)))
+	err := client.Run(ctx, req, nil)
+	is.NoErr(err)
+	mu.Lock()
+	defer mu.Unlock()
+	is.True(len(reports) > 0)
+	is.True(contentLength > 1<<20)
+	is.Equal(reports[len(reports)-1], [2]int64{contentLength, contentLength}) // complete
+	for i := 1; i < len(reports); i++ {
+		is.True(reports[i][0] > reports[i-1][0]) // increasing
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	is := is.New(t)
+
+	body := `{"data":{"something":"` + strings.Repeat("x", 1<<20) + `"}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	var reports [][2]int64
+	client := NewClient(srv.URL, WithDownloadProgress(func(received, total int64) {
+		reports = append(reports, [2]int64{received, total})
+	}))
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.NoErr(err)
+	size := int64(len(body))
+	is.Equal(reports[len(reports)-1], [2]int64{size, size}) // complete
+}
+
+// seeker is an io.ReadSeeker without a Len method.
+type seeker struct {
+	r *bytes.Reader
+}
+
+func (s seeker) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func (s seeker) Seek(offset int64, whence int) (int64, error) {
+	return s.r.Seek(offset, whence)
+}
+
+func TestProgressSeeker(t *testing.T) {
+	is := is.New(t)
+
+	var contentLength int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		_, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	var totals []int64
+	client := NewClient(srv.URL, UseMultipartForm(), WithProgress(func(sent, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		totals = append(totals, total)
+	}))
+
+	s := seeker{r: bytes.NewReader(make([]byte, 1000))}
+	_, err := s.Seek(100, io.SeekStart)
+	is.NoErr(err)
+	size, ok := filesSize([]File{{R: s}})
+	is.True(ok)
+	is.Equal(size, int64(900)) // from the current offset
+	offset, err := s.Seek(0, io.SeekCurrent)
+	is.NoErr(err)
+	is.Equal(offset, int64(100)) // offset restored
+
+	req := NewRequest("mutation {}")
+	req.File("file", "filename.txt", s)
+	is.NoErr(client.Run(ctx, req, nil))
+	mu.Lock()
+	defer mu.Unlock()
+	is.True(len(totals) > 0)
+	is.True(contentLength > 900)
+	is.Equal(totals[0], contentLength) // known total
+}
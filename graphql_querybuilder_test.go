@@ -0,0 +1,65 @@
+package graphql
+
+import (
+	"math"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	is := is.New(t)
+
+	q, err := NewQueryBuilder("items").
+		Var("key", "ID!").
+		Arg("id", "$key").
+		Select("field1", "field2").
+		Build()
+	is.NoErr(err)
+	is.Equal(q, "query ($key: ID!) { items(id: $key) { field1 field2 } }")
+
+	q, err = NewQueryBuilder("createReview").
+		Operation("mutation", "CreateReview").
+		Var("$episode", "Episode").
+		Arg("episode", "$episode").
+		Arg("review", map[string]interface{}{"stars": 5, "commentary": `This is a "great" movie!`, "tags": []string{"a", "b"}, "spoiler": false, "note": nil}).
+		Select("stars").
+		SelectField(NewQueryBuilder("author").Var("size", "Int").Select("name").
+			SelectField(NewQueryBuilder("avatar").Arg("size", "$size").Select("url"))).
+		Build()
+	is.NoErr(err)
+	is.Equal(q, `mutation CreateReview ($episode: Episode, $size: Int) { createReview(episode: $episode, review: {commentary: "This is a \"great\" movie!", note: null, spoiler: false, stars: 5, tags: ["a", "b"]}) { stars author { name avatar(size: $size) { url } } } }`)
+
+	q, err = NewQueryBuilder("viewer").Build()
+	is.NoErr(err)
+	is.Equal(q, "query { viewer }")
+	q, err = NewQueryBuilder("hero").Operation("query", "Hero").Select("name").Build()
+	is.NoErr(err)
+	is.Equal(NewRequest(q).OperationName(), "Hero")
+}
+
+func TestQueryBuilderValues(t *testing.T) {
+	is := is.New(t)
+
+	type episode string
+	stars := 4.5
+	var missing *int
+	q, err := NewQueryBuilder("search").
+		Arg("filter", map[string]string{"b": "x", "a": "$a"}).
+		Arg("ids", []int{1, 2}).
+		Arg("nested", map[string][]uint8{"bytes": {1}}).
+		Arg("episode", episode("JEDI")).
+		Arg("stars", &stars).
+		Arg("missing", missing).
+		Arg("pair", [2]bool{true, false}).
+		Build()
+	is.NoErr(err)
+	is.Equal(q, `query { search(filter: {a: $a, b: "x"}, ids: [1, 2], nested: {bytes: [1]}, episode: "JEDI", stars: 4.5, missing: null, pair: [true, false]) }`)
+
+	_, err = NewQueryBuilder("search").Arg("filter", struct{ A int }{1}).Build()
+	is.Equal(err.Error(), "graphql: argument filter of search: unsupported value of type struct { A int }")
+	_, err = NewQueryBuilder("search").Arg("filter", map[int]string{1: "a"}).Build()
+	is.Equal(err.Error(), "graphql: argument filter of search: unsupported map key type int")
+	_, err = NewQueryBuilder("search").SelectField(NewQueryBuilder("items").Arg("first", math.Inf(1))).Build()
+	is.True(err != nil)
+}
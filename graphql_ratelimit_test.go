@@ -0,0 +1,60 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestRateLimit(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRateLimit(20, 2))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		err := client.Run(ctx, NewRequest("query {}"), nil)
+		is.NoErr(err)
+	}
+	// the burst goes through at once, then a request every 50ms
+	is.True(time.Since(start) >= 90*time.Millisecond)
+	is.Equal(calls, 4) // calls
+}
+
+func TestRateLimitCancelled(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, WithRateLimit(1, 1))
+	err := client.Run(context.Background(), NewRequest("query {}"), nil)
+	is.NoErr(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = client.Run(ctx, NewRequest("query {}"), nil)
+	is.True(errors.Is(err, context.DeadlineExceeded))
+	is.True(time.Since(start) < 500*time.Millisecond) // stops waiting with ctx
+	is.Equal(calls, 1)                                // calls
+}
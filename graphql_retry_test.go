@@ -0,0 +1,357 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestRetryStatusCode(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		b, err := ioutil.ReadAll(r.Body)
+		is.NoErr(err)
+		is.Equal(string(b), `{"query":"query {}","variables":null}`+"\n")
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	var attempts []int
+	client := NewClient(srv.URL, WithRetry(3, func(attempt int) time.Duration {
+		attempts = append(attempts, attempt)
+		return time.Millisecond
+	}))
+
+	var responseData map[string]interface{}
+	err := client.Run(ctx, NewRequest("query {}"), &responseData)
+	is.NoErr(err)
+	is.Equal(calls, 3) // calls
+	is.Equal(attempts, []int{1, 2})
+	is.Equal(responseData["something"], "yes")
+}
+
+func TestRetryExhausted(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, `Bad Gateway`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetry(2, nil))
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.Equal(calls, 2) // calls
+	var retryErr *RetryError
+	is.True(errors.As(err, &retryErr))
+	is.Equal(retryErr.Attempt, 2)
+	is.Equal(err.Error(), "graphql: attempt 2 failed: graphql: server returned a non-200 status code: 502")
+}
+
+func TestRetryNetworkError(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	testClient := &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			if calls == 1 {
+				return nil, errors.New("connection reset")
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"data":{"key":"value"}}`)),
+			}, nil
+		}),
+	}
+
+	client := NewClient("", WithHTTPClient(testClient), WithRetry(2, nil))
+
+	var responseData map[string]interface{}
+	err := client.Run(context.Background(), NewRequest("query {}"), &responseData)
+	is.NoErr(err)
+	is.Equal(calls, 2) // calls
+	is.Equal(responseData["key"], "value")
+}
+
+func TestRetryStatusCodes(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetry(3, nil), WithRetryStatusCodes(http.StatusTooManyRequests))
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.Equal(calls, 1) // calls
+	is.Equal(err.Error(), "graphql: server returned a non-200 status code: 503")
+}
+
+func TestRetrySkipsUploads(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, UseMultipartForm(), WithRetry(3, nil))
+
+	req := NewRequest("query {}")
+	req.File("file", "filename.txt", strings.NewReader(`This is a file`))
+	err := client.Run(ctx, req, nil)
+	is.True(err != nil)
+	is.Equal(calls, 1) // calls
+
+	calls = 0
+	client = NewClient(srv.URL, UseMultipartForm(), WithRetry(3, nil), WithRetryUploads())
+	req = NewRequest("query {}")
+	req.File("file", "filename.txt", strings.NewReader(`This is a file`))
+	err = client.Run(ctx, req, nil)
+	is.True(err != nil)
+	is.Equal(calls, 3) // calls
+}
+
+func TestRetryStopsAtDeadline(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetry(5, func(int) time.Duration {
+		return time.Second
+	}))
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.Equal(calls, 1) // calls
+	is.Equal(err.Error(), "graphql: attempt 1 failed: graphql: server returned a non-200 status code: 503")
+}
+
+func TestRetryIdempotencyKey(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("Idempotency-Key"), "charge-42")
+		if calls < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{"charge":"ok"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetry(3, func(attempt int) time.Duration {
+		return time.Millisecond
+	}))
+
+	req := NewRequest("mutation { charge }")
+	req.SetIdempotencyKey("charge-42")
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(calls, 2) // calls
+	is.Equal(req.Clone().Header.Get("Idempotency-Key"), "charge-42")
+}
+
+func TestRetryReplayableBody(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.NoErr(r.ParseMultipartForm(1 << 20))
+		for field, content := range map[string]string{"small": "tiny", "large": strings.Repeat("large file ", 10)} {
+			f, _, err := r.FormFile(field)
+			is.NoErr(err)
+			b, err := ioutil.ReadAll(f)
+			is.NoErr(err)
+			is.Equal(string(b), content)
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	tmp, err := ioutil.TempDir("", "graphql-test-")
+	is.NoErr(err)
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+
+	client := NewClient(srv.URL, UseMultipartForm(), WithRetry(3, nil), WithReplayableBody())
+	client.replayMemoryLimit = 16 // the large file is kept in a temporary file
+	req := NewRequest("mutation {}")
+	// readers that can only be read once
+	req.File("small", "small.txt", ioutil.NopCloser(strings.NewReader("tiny")))
+	req.File("large", "large.txt", ioutil.NopCloser(strings.NewReader(strings.Repeat("large file ", 10))))
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(calls, 3)
+	left, err := ioutil.ReadDir(tmp)
+	is.NoErr(err)
+	is.Equal(len(left), 0) // temporary files removed
+}
+
+func TestRetryBudget(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetry(10, func(int) time.Duration {
+		return 40 * time.Millisecond
+	}), WithRetryBudget(100*time.Millisecond))
+
+	start := time.Now()
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.True(time.Since(start) < 100*time.Millisecond) // stops within the budget
+	is.Equal(calls, 3)                                // calls
+	is.Equal(err.Error(), "graphql: attempt 3 failed: graphql: server returned a non-200 status code: 503")
+}
+
+func TestRetryBudgetWithoutAttempts(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 4 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetryBudget(500*time.Millisecond))
+
+	var responseData map[string]interface{}
+	err := client.Run(ctx, NewRequest("query {}"), &responseData)
+	is.NoErr(err)
+	is.Equal(calls, 4) // calls
+	is.Equal(responseData["something"], "yes")
+}
+
+func TestRetryBudgetBackoff(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetryBudget(200*time.Millisecond))
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.True(err != nil)
+	is.True(calls >= 3) // retried
+	is.True(calls <= 5) // spaced by the default backoff
+}
+
+func TestRetryableErrorCodes(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			io.WriteString(w, `{"errors":[{"message":"slow down","extensions":{"code":"RATE_LIMITED"}}]}`)
+			return
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetry(3, nil), WithRetryableErrorCodes("RATE_LIMITED"))
+
+	var responseData map[string]interface{}
+	err := client.Run(ctx, NewRequest("query {}"), &responseData)
+	is.NoErr(err)
+	is.Equal(calls, 3) // calls
+	is.Equal(responseData["something"], "yes")
+}
+
+func TestRetryableErrorCodesOtherCode(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"errors":[{"message":"slow down","extensions":{"code":"RATE_LIMITED"}},{"message":"bad id","extensions":{"code":"BAD_USER_INPUT"}}]}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetry(3, nil), WithRetryableErrorCodes("RATE_LIMITED"))
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.Equal(calls, 1) // calls
+	is.Equal(err.Error(), "graphql: slow down | bad id")
+}
+
+func TestRetryableErrorCodesExhausted(t *testing.T) {
+	is := is.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"errors":[{"message":"slow down","extensions":{"code":"RATE_LIMITED"}}]}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRetry(2, nil), WithRetryableErrorCodes("RATE_LIMITED"))
+
+	err := client.Run(ctx, NewRequest("query {}"), nil)
+	is.Equal(calls, 2) // calls
+	var retryErr *RetryError
+	is.True(errors.As(err, &retryErr))
+	is.Equal(retryErr.Attempt, 2)
+}
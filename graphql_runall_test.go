@@ -0,0 +1,140 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestRunAll(t *testing.T) {
+	is := is.New(t)
+
+	var running, maxRunning int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		var body struct {
+			Query string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body.Query == "query { fail }" {
+			io.WriteString(w, `{"errors":[{"message":"failed"}]}`)
+			return
+		}
+		io.WriteString(w, `{"data":{"query":"`+body.Query+`"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithRunAllConcurrency(2))
+
+	queries := []string{"query { a }", "query { fail }", "query { b }", "query { c }", "query { d }"}
+	resps := make([]struct{ Query string }, len(queries))
+	jobs := make([]RunJob, len(queries))
+	for i, q := range queries {
+		jobs[i] = RunJob{Request: NewRequest(q), Response: &resps[i]}
+	}
+	errs := client.RunAll(ctx, jobs)
+	is.Equal(len(errs), len(jobs))
+	for i, q := range queries {
+		if i == 1 {
+			is.Equal(errs[i].Error(), "graphql: failed")
+			continue
+		}
+		is.NoErr(errs[i])
+		is.Equal(resps[i].Query, q)
+	}
+	is.Equal(atomic.LoadInt32(&maxRunning), int32(2)) // concurrency limit
+}
+
+func TestRunAllCancelled(t *testing.T) {
+	is := is.New(t)
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		io.WriteString(w, `{"data":{}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := NewClient(srv.URL)
+
+	errs := client.RunAll(ctx, []RunJob{
+		{Request: NewRequest("query { a }")},
+		{Request: NewRequest("query { b }")},
+	})
+	is.Equal(atomic.LoadInt32(&calls), int32(0)) // calls
+	for _, err := range errs {
+		is.True(errors.Is(err, context.Canceled))
+	}
+}
+
+func TestRunAllSharedRequest(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string
+			Variables map[string]interface{}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body.Query == "" {
+			io.WriteString(w, `{"errors":[{"message":"PersistedQueryNotFound"}]}`)
+			return
+		}
+		io.WriteString(w, `{"data":{"query":"`+body.Query+`","tenant":"`+body.Variables["tenant"].(string)+`"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL,
+		WithPersistedQueries(),
+		WithBaseVariables(map[string]interface{}{"tenant": "acme"}),
+		WithQueryTransform(func(q string) (string, error) {
+			return q + " # transformed", nil
+		}),
+	)
+
+	req := NewRequest("query { a }")
+	req.Var("id", 1)
+	resps := make([]struct{ Query, Tenant string }, 8)
+	jobs := make([]RunJob, len(resps))
+	for i := range jobs {
+		jobs[i] = RunJob{Request: req, Response: &resps[i]}
+	}
+	for i, err := range client.RunAll(ctx, jobs) {
+		is.NoErr(err)
+		is.Equal(resps[i].Query, "query { a } # transformed")
+		is.Equal(resps[i].Tenant, "acme")
+	}
+	// the request is left as it was built
+	is.Equal(req.Query(), "query { a }")
+	is.Equal(req.Vars(), map[string]interface{}{"id": 1})
+	is.Equal(req.extensions, nil)
+	is.Equal(req.method, "")
+}
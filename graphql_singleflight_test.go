@@ -0,0 +1,107 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestSingleflight(t *testing.T) {
+	is := is.New(t)
+
+	var calls int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	var joined int32
+	client := NewClient(srv.URL, WithSingleflight())
+	client.Log = func(s string) {
+		if strings.HasSuffix(s, "] >> joining identical request in flight") {
+			atomic.AddInt32(&joined, 1)
+		}
+	}
+
+	const n = 5
+	var wg sync.WaitGroup
+	resps := make([]map[string]interface{}, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := NewRequest("query ($id: ID) { something }")
+			req.Var("id", "1")
+			errs[i] = client.Run(ctx, req, &resps[i])
+		}(i)
+	}
+	for atomic.LoadInt32(&joined) < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	is.Equal(atomic.LoadInt32(&calls), int32(1)) // calls
+	for i := 0; i < n; i++ {
+		is.NoErr(errs[i])
+		is.Equal(resps[i]["something"], "yes")
+	}
+
+	// requests with other variables aren't coalesced
+	req := NewRequest("query ($id: ID) { something }")
+	req.Var("id", "2")
+	is.NoErr(client.Run(ctx, req, nil))
+	is.Equal(atomic.LoadInt32(&calls), int32(2))
+}
+
+func TestSingleflightMutations(t *testing.T) {
+	is := is.New(t)
+
+	var calls int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		io.WriteString(w, `{"data":{"charge":true}}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithSingleflight())
+
+	const n = 3
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.Run(ctx, NewRequest("mutation { charge(amount: 5) }"), nil)
+		}(i)
+	}
+	for atomic.LoadInt32(&calls) < n && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	is.Equal(atomic.LoadInt32(&calls), int32(n)) // every mutation is sent
+	for i := 0; i < n; i++ {
+		is.NoErr(errs[i])
+	}
+}
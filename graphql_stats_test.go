@@ -0,0 +1,61 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestStats(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			io.WriteString(w, `{"errors":[{"message":"boom"}]}`)
+			return
+		}
+		io.WriteString(w, `{"data":{"something":"yes"}}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	is.Equal(NewClient(srv.URL).Stats(), Stats{})
+
+	client := NewClient(srv.URL, WithStats())
+	is.Equal(client.Stats(), Stats{})
+	for i := 0; i < 3; i++ {
+		is.NoErr(client.Run(ctx, NewRequest("query {}"), nil))
+	}
+	failing := NewClient(srv.URL+"?fail=1", WithStats())
+	is.True(failing.Run(ctx, NewRequest("query {}"), nil) != nil)
+	is.Equal(failing.Stats().Errors, int64(1))
+
+	stats := client.Stats()
+	is.Equal(stats.Requests, int64(3))
+	is.Equal(stats.Errors, int64(0))
+	is.True(stats.Min > 0)
+	is.True(stats.Min <= stats.P50)
+	is.True(stats.P50 <= stats.P99)
+	is.True(stats.P99 <= stats.Max)
+	is.True(stats.Min <= stats.Avg && stats.Avg <= stats.Max)
+}
+
+func TestStatsPercentiles(t *testing.T) {
+	is := is.New(t)
+	c := &Client{}
+	WithStats()(c)
+	for i := 1; i <= 100; i++ {
+		c.stats.observe(time.Duration(i)*time.Millisecond, nil)
+	}
+	stats := c.Stats()
+	is.Equal(stats.Min, 1*time.Millisecond)
+	is.Equal(stats.Max, 100*time.Millisecond)
+	is.Equal(stats.P50, 50*time.Millisecond)
+	is.Equal(stats.P99, 99*time.Millisecond)
+	is.Equal(stats.Avg, 50500*time.Microsecond)
+}
@@ -0,0 +1,97 @@
+package graphql
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRunStream(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		is.Equal(r.Header.Get("Accept"), "multipart/mixed; deferSpec=20220824, application/json")
+		w.Header().Set("Content-Type", `multipart/mixed; boundary="-"`)
+		parts := []string{
+			`{"data":{"user":{"name":"Mat","friends":[{"name":"A"}]}},"hasNext":true}`,
+			`{"incremental":[{"data":{"bio":"Gopher"},"path":["user"],"label":"Bio"}],"hasNext":true}`,
+			`{"incremental":[{"items":[{"name":"B"},{"name":"C"}],"path":["user","friends",1]}],"hasNext":true}`,
+			`{"hasNext":false}`,
+		}
+		for _, part := range parts {
+			io.WriteString(w, "\r\n---\r\nContent-Type: application/json; charset=utf-8\r\n\r\n"+part)
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, "\r\n-----\r\n")
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+	ch, err := client.RunStream(ctx, NewRequest(`query { user { name friends @stream(initialCount: 1) { name } ... @defer(label: "Bio") { bio } } }`))
+	is.NoErr(err)
+
+	var payloads []Payload
+	for p := range ch {
+		is.NoErr(p.Err)
+		payloads = append(payloads, p)
+	}
+	is.Equal(calls, 1)
+	is.Equal(len(payloads), 4)
+	is.Equal(string(payloads[0].Data), `{"user":{"friends":[{"name":"A"}],"name":"Mat"}}`)
+	is.True(payloads[0].HasNext)
+	is.Equal(string(payloads[1].Data), `{"user":{"bio":"Gopher","friends":[{"name":"A"}],"name":"Mat"}}`)
+	is.Equal(payloads[1].Label, "Bio")
+	is.Equal(payloads[1].Path, []interface{}{"user"})
+	is.Equal(string(payloads[2].Data), `{"user":{"bio":"Gopher","friends":[{"name":"A"},{"name":"B"},{"name":"C"}],"name":"Mat"}}`)
+	is.True(payloads[2].HasNext)
+	is.Equal(string(payloads[3].Data), string(payloads[2].Data))
+	is.True(!payloads[3].HasNext)
+}
+
+func TestRunStreamSingleResult(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"data":{"user":{"name":"Mat"}},"errors":[{"message":"partial"}]}`)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL)
+	ch, err := client.RunStream(ctx, NewRequest(`query { user { name } }`))
+	is.NoErr(err)
+	p, ok := <-ch
+	is.True(ok)
+	is.Equal(string(p.Data), `{"user":{"name":"Mat"}}`)
+	is.Equal(p.Errors[0].Message, "partial")
+	is.True(!p.HasNext)
+	_, ok = <-ch
+	is.True(!ok) // channel closed
+}
+
+func TestRunStreamServerError(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, `bad gateway`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	_, err := client.RunStream(context.Background(), NewRequest(`query { user { name } }`))
+	statusErr, ok := err.(*StatusError)
+	is.True(ok)
+	is.Equal(statusErr.StatusCode, http.StatusBadGateway)
+}
@@ -0,0 +1,217 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestSubscribe(t *testing.T) {
+	is := is.New(t)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("Authorization"), "Bearer token")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		is.Equal(conn.Subprotocol(), "graphql-transport-ws")
+
+		var msg map[string]interface{}
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg["type"], "connection_init")
+		is.Equal(msg["payload"], map[string]interface{}{"token": "abc"})
+		is.NoErr(conn.WriteJSON(map[string]interface{}{"type": "connection_ack"}))
+
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg["type"], "subscribe")
+		is.Equal(msg["payload"], map[string]interface{}{
+			"query":     "subscription { added }",
+			"variables": map[string]interface{}{"key": "value"},
+		})
+		id := msg["id"]
+		is.NoErr(conn.WriteJSON(map[string]interface{}{"type": "ping"}))
+		is.NoErr(conn.WriteJSON(map[string]interface{}{"id": id, "type": "next", "payload": map[string]interface{}{"data": map[string]interface{}{"added": 1}}}))
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg["type"], "pong")
+		is.NoErr(conn.WriteJSON(map[string]interface{}{"id": id, "type": "next", "payload": map[string]interface{}{"errors": []interface{}{map[string]interface{}{"message": "oops"}}}}))
+		is.NoErr(conn.WriteJSON(map[string]interface{}{"id": id, "type": "complete"}))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL, WithBearerToken("token"), WithSubscriptionInitPayload(map[string]interface{}{"token": "abc"}))
+
+	req := NewRequest("subscription { added }")
+	req.Var("key", "value")
+	ch, err := client.Subscribe(ctx, req)
+	is.NoErr(err)
+
+	var msgs []SubscriptionMessage
+	for msg := range ch {
+		msgs = append(msgs, msg)
+	}
+	is.Equal(len(msgs), 2)
+	var data struct{ Added int }
+	is.NoErr(json.Unmarshal(msgs[0].Data, &data))
+	is.Equal(data.Added, 1)
+	is.Equal(msgs[1].Errors.Error(), "graphql: oops")
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	is := is.New(t)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	completed := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		var msg map[string]interface{}
+		is.NoErr(conn.ReadJSON(&msg))
+		is.NoErr(conn.WriteJSON(map[string]interface{}{"type": "connection_ack"}))
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg["type"], "subscribe")
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg["type"], "complete")
+		close(completed)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewClient(srv.URL)
+
+	ch, err := client.Subscribe(ctx, NewRequest("subscription { added }"))
+	is.NoErr(err)
+	cancel()
+	for range ch {
+	}
+	select {
+	case <-completed:
+	case <-time.After(time.Second):
+		t.Fatal("subscription not completed")
+	}
+}
+
+func TestWebsocketURL(t *testing.T) {
+	is := is.New(t)
+	u, err := websocketURL("https://example.com/graphql")
+	is.NoErr(err)
+	is.Equal(u, "wss://example.com/graphql")
+	u, err = websocketURL("http://example.com/graphql")
+	is.NoErr(err)
+	is.Equal(u, "ws://example.com/graphql")
+}
+
+func TestSubscribeCancelBeforeAck(t *testing.T) {
+	is := is.New(t)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		is.NoErr(err)
+		defer conn.Close()
+		var msg map[string]interface{}
+		is.NoErr(conn.ReadJSON(&msg))
+		is.Equal(msg["type"], "connection_init")
+		// never acknowledged
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := NewClient(srv.URL).Subscribe(ctx, NewRequest("subscription { added }"))
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		var canceled *CanceledError
+		is.True(errors.As(err, &canceled))
+		is.True(errors.Is(err, context.Canceled))
+	case <-time.After(time.Second):
+		is.Fail() // Subscribe didn't return
+	}
+}
+
+func TestSubscribeSSE(t *testing.T) {
+	is := is.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Method, http.MethodPost)
+		is.Equal(r.Header.Get("Accept"), "text/event-stream")
+		is.Equal(r.Header.Get("Authorization"), "Bearer token")
+		var body struct {
+			Query     string
+			Variables map[string]interface{}
+		}
+		is.NoErr(json.NewDecoder(r.Body).Decode(&body))
+		is.Equal(body.Query, "subscription { reviews { stars } }")
+		is.Equal(body.Variables["episode"], "JEDI")
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, ": keep-alive\n\n")
+		io.WriteString(w, "event: next\ndata: {\"data\":{\"reviews\":{\"stars\":5}}}\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "event: next\r\ndata: {\"data\":null,\r\ndata: \"errors\":[{\"message\":\"boom\"}]}\r\n\r\n")
+		io.WriteString(w, "event: complete\ndata:\n\n")
+		io.WriteString(w, "event: next\ndata: {\"data\":{}}\n\n") // after complete
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := NewClient(srv.URL, WithBearerToken("token"))
+	req := NewRequest("subscription { reviews { stars } }")
+	req.Var("episode", "JEDI")
+	ch, err := client.SubscribeSSE(ctx, req)
+	is.NoErr(err)
+	var msgs []SubscriptionMessage
+	for msg := range ch {
+		msgs = append(msgs, msg)
+	}
+	is.Equal(len(msgs), 2)
+	is.NoErr(msgs[0].Err)
+	is.Equal(string(msgs[0].Data), `{"reviews":{"stars":5}}`)
+	is.Equal(msgs[1].Errors[0].Message, "boom")
+}
+
+func TestSubscribeSSECancel(t *testing.T) {
+	is := is.New(t)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: next\ndata: {\"data\":{\"n\":1}}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch, err := NewClient(srv.URL).SubscribeSSE(ctx, NewRequest("subscription { n }"))
+	is.NoErr(err)
+	msg := <-ch
+	is.Equal(string(msg.Data), `{"n":1}`)
+	cancel()
+	select {
+	case _, ok := <-ch:
+		is.True(!ok)
+	case <-time.After(1 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+
+	_, err = NewClient(srv.URL).SubscribeSSE(context.Background(), &Request{q: "subscription { n }", files: []File{{Field: "f"}}})
+	is.Equal(err.Error(), "cannot subscribe with files")
+}
@@ -0,0 +1,74 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestRunToWriter(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.Header.Get("Accept"), "application/json")
+		io.WriteString(w, `{ "extensions": {"cost": [1, 2.5, true, null]}, "data": {"records": [{"id": "1", "name": "a \"quoted\" } name"}, {"id": 2}], "done": false} }`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	var buf bytes.Buffer
+	err := client.RunToWriter(ctx, NewRequest("query { records { id name } }"), &buf)
+	is.NoErr(err)
+	is.Equal(buf.String(), `{"records": [{"id": "1", "name": "a \"quoted\" } name"}, {"id": 2}], "done": false}`)
+}
+
+func TestRunToWriterErrors(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"records":null},"errors":[{"message":"too many records","path":["records"]}]}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	var buf bytes.Buffer
+	err := client.RunToWriter(ctx, NewRequest("query { records { id } }"), &buf)
+	is.Equal(buf.String(), `{"records":null}`)
+	var errs Errors
+	is.True(errors.As(err, &errs))
+	is.Equal(len(errs), 1)
+	is.Equal(errs[0].Message, "too many records")
+	is.Equal(string(errs[0].Raw), `{"message":"too many records","path":["records"]}`)
+}
+
+func TestRunToWriterTruncated(t *testing.T) {
+	is := is.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"records":[{"id":"1"}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	client := NewClient(srv.URL)
+
+	var buf bytes.Buffer
+	err := client.RunToWriter(ctx, NewRequest("query { records { id } }"), &buf)
+	var netErr *NetworkError
+	is.True(errors.As(err, &netErr))
+	is.True(errors.Is(err, io.ErrUnexpectedEOF))
+}
@@ -0,0 +1,230 @@
+// Package graphqltest provides a GraphQL server serving canned responses
+// for testing code that uses the graphql client.
+//
+//  srv := graphqltest.NewServer(func(req *graphql.Request) (interface{}, error) {
+//      if req.Vars()["id"] != "123" {
+//          return nil, errors.New("not found")
+//      }
+//      return map[string]interface{}{"item": map[string]interface{}{"id": "123"}}, nil
+//  })
+//  defer srv.Close()
+//  client := graphql.NewClient(srv.URL)
+package graphqltest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+
+	"github.com/ikozinov/graphql"
+	"github.com/pkg/errors"
+)
+
+// Handler answers a GraphQL request with the data of the response, or
+// an error. Returning graphql.Errors, a graphql.Error or a
+// *graphql.PartialError sends those errors in the response as is, along
+// with the data; other errors are sent as a single error with their
+// message.
+type Handler func(req *graphql.Request) (interface{}, error)
+
+// NewServer starts a server calling handler for every GraphQL request it
+// receives. Requests can be sent as JSON, as a GET with URL parameters,
+// as a multipart form (graphql.UseMultipartForm) or following the
+// multipart request specification (graphql.UseMultipartRequestSpec).
+// Uploaded files are available from Request.Files, and batches are
+// answered one request at a time.
+// The caller must Close the server.
+func NewServer(handler Handler) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, batch, err := decodeRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var res interface{}
+		if batch {
+			results := make([]response, len(body))
+			for i, req := range body {
+				results[i] = respond(handler, req)
+			}
+			res = results
+		} else {
+			res = respond(handler, body[0])
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(res)
+	}))
+}
+
+// response is the JSON body of a GraphQL response.
+type response struct {
+	Data   interface{}     `json:"data"`
+	Errors []responseError `json:"errors,omitempty"`
+}
+
+type responseError struct {
+	Message    string                 `json:"message"`
+	Locations  []graphql.Location     `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func respond(handler Handler, req *graphql.Request) response {
+	data, err := handler(req)
+	if err == nil {
+		return response{Data: data}
+	}
+	var errs graphql.Errors
+	var partial *graphql.PartialError
+	var single graphql.Error
+	switch {
+	case errors.As(err, &partial):
+		errs = partial.Errors
+	case errors.As(err, &errs):
+	case errors.As(err, &single):
+		errs = graphql.Errors{single}
+	default:
+		errs = graphql.Errors{{Message: err.Error()}}
+	}
+	res := response{Data: data}
+	for _, e := range errs {
+		res.Errors = append(res.Errors, responseError{
+			Message:    e.Message,
+			Locations:  e.Locations,
+			Path:       e.Path,
+			Extensions: e.Extensions,
+		})
+	}
+	return res
+}
+
+// params are the parameters of a GraphQL request.
+type params struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+func (p params) request(header http.Header) *graphql.Request {
+	req := graphql.NewRequest(p.Query)
+	for key, value := range p.Variables {
+		req.Var(key, value)
+	}
+	req.OpName = p.OperationName
+	req.Header = header
+	return req
+}
+
+// decodeRequest decodes the GraphQL requests sent in r, and reports
+// whether they were sent as a batch.
+func decodeRequest(r *http.Request) ([]*graphql.Request, bool, error) {
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		p := params{
+			Query:         q.Get("query"),
+			OperationName: q.Get("operationName"),
+		}
+		if variables := q.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &p.Variables); err != nil {
+				return nil, false, errors.Wrap(err, "decode variables")
+			}
+		}
+		return []*graphql.Request{p.request(r.Header)}, false, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, false, errors.Wrap(err, "parse content type")
+	}
+	if mediaType == "multipart/form-data" {
+		req, err := decodeMultipart(r)
+		if err != nil {
+			return nil, false, err
+		}
+		return []*graphql.Request{req}, false, nil
+	}
+	var body io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "decompress body")
+		}
+		defer zr.Close()
+		body = zr
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "read body")
+	}
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []params
+		if err := json.Unmarshal(b, &batch); err != nil {
+			return nil, false, errors.Wrap(err, "decode body")
+		}
+		reqs := make([]*graphql.Request, len(batch))
+		for i := range batch {
+			reqs[i] = batch[i].request(r.Header)
+		}
+		return reqs, true, nil
+	}
+	var p params
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, false, errors.Wrap(err, "decode body")
+	}
+	return []*graphql.Request{p.request(r.Header)}, false, nil
+}
+
+// decodeMultipart decodes a request sent as a multipart form, either with
+// query and variables fields or following the multipart request
+// specification with operations and map fields.
+func decodeMultipart(r *http.Request) (*graphql.Request, error) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return nil, errors.Wrap(err, "parse multipart form")
+	}
+	form := r.MultipartForm
+	var p params
+	if operations := form.Value["operations"]; len(operations) > 0 {
+		if err := json.Unmarshal([]byte(operations[0]), &p); err != nil {
+			return nil, errors.Wrap(err, "decode operations")
+		}
+	} else {
+		if query := form.Value["query"]; len(query) > 0 {
+			p.Query = query[0]
+		}
+		if operationName := form.Value["operationName"]; len(operationName) > 0 {
+			p.OperationName = operationName[0]
+		}
+		if variables := form.Value["variables"]; len(variables) > 0 {
+			if err := json.Unmarshal([]byte(variables[0]), &p.Variables); err != nil {
+				return nil, errors.Wrap(err, "decode variables")
+			}
+		}
+	}
+	req := p.request(r.Header)
+	fields := make([]string, 0, len(form.File))
+	for field := range form.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		for _, header := range form.File[field] {
+			f, err := header.Open()
+			if err != nil {
+				return nil, errors.Wrap(err, "open file")
+			}
+			b, err := ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, errors.Wrap(err, "read file")
+			}
+			req.FileWithType(field, header.Filename, header.Header.Get("Content-Type"), bytes.NewReader(b))
+		}
+	}
+	return req, nil
+}
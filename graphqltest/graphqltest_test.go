@@ -0,0 +1,125 @@
+package graphqltest
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ikozinov/graphql"
+	"github.com/matryer/is"
+	"github.com/pkg/errors"
+)
+
+func TestServerJSON(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := NewServer(func(req *graphql.Request) (interface{}, error) {
+		calls++
+		is.Equal(req.Query(), "query Item($id: ID!) { item(id: $id) { name } }")
+		is.Equal(req.OpName, "Item")
+		is.Equal(req.Header.Get("X-Tenant"), "acme")
+		if req.Vars()["id"] != "123" {
+			return nil, errors.New("not found")
+		}
+		return map[string]interface{}{"item": map[string]interface{}{"name": "thing"}}, nil
+	})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := graphql.NewClient(srv.URL, graphql.WithHeader("X-Tenant", "acme"))
+	req := graphql.NewRequest("query Item($id: ID!) { item(id: $id) { name } }")
+	req.OpName = "Item"
+	req.Var("id", "123")
+	var resp struct {
+		Item struct{ Name string }
+	}
+	is.NoErr(client.Run(ctx, req, &resp))
+	is.Equal(resp.Item.Name, "thing")
+
+	req.Var("id", "456")
+	err := client.Run(ctx, req, nil)
+	is.Equal(err.Error(), "graphql: not found")
+	is.Equal(calls, 2)
+}
+
+func TestServerErrors(t *testing.T) {
+	is := is.New(t)
+
+	srv := NewServer(func(req *graphql.Request) (interface{}, error) {
+		return map[string]interface{}{"user": nil}, graphql.Errors{{
+			Message:    "forbidden",
+			Path:       []interface{}{"user"},
+			Extensions: map[string]interface{}{"code": "FORBIDDEN"},
+		}}
+	})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := graphql.NewClient(srv.URL)
+	err := client.Run(ctx, graphql.NewRequest("query { user { name } }"), nil)
+	var errs graphql.Errors
+	is.True(errors.As(err, &errs))
+	is.Equal(len(errs.ForPath("user")), 1)
+	is.True(errs.HasExtensionCode("FORBIDDEN"))
+}
+
+func TestServerMultipart(t *testing.T) {
+	is := is.New(t)
+
+	var calls int
+	srv := NewServer(func(req *graphql.Request) (interface{}, error) {
+		calls++
+		is.Equal(req.Vars()["title"], "holiday")
+		is.Equal(len(req.Files()), 2)
+		is.Equal(req.Files()[0].Name, "one.txt")
+		b, err := ioutil.ReadAll(req.Files()[0].R)
+		is.NoErr(err)
+		is.Equal(string(b), "first")
+		is.Equal(req.Files()[1].Name, "two.txt")
+		return map[string]interface{}{"upload": true}, nil
+	})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	for _, opt := range []graphql.ClientOption{graphql.UseMultipartForm(), graphql.UseMultipartRequestSpec()} {
+		client := graphql.NewClient(srv.URL, opt)
+		req := graphql.NewRequest("mutation ($title: String!, $files: [Upload!]!) { upload }")
+		req.Var("title", "holiday")
+		req.File("file1", "one.txt", strings.NewReader("first"))
+		req.File("file2", "two.txt", strings.NewReader("second"))
+		var resp struct{ Upload bool }
+		is.NoErr(client.Run(ctx, req, &resp))
+		is.True(resp.Upload)
+	}
+	is.Equal(calls, 2)
+}
+
+func TestServerBatch(t *testing.T) {
+	is := is.New(t)
+
+	srv := NewServer(func(req *graphql.Request) (interface{}, error) {
+		return map[string]interface{}{"echo": req.Vars()["n"]}, nil
+	})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	client := graphql.NewClient(srv.URL)
+	one := graphql.NewRequest("query ($n: Int) { echo(n: $n) }")
+	one.Var("n", 1)
+	two := graphql.NewRequest("query ($n: Int) { echo(n: $n) }")
+	two.Var("n", 2)
+	var resp1, resp2 struct{ Echo int }
+	errs, err := client.RunBatch(ctx, graphql.NewBatch(one, two), []interface{}{&resp1, &resp2})
+	is.NoErr(err)
+	is.NoErr(errs[0])
+	is.NoErr(errs[1])
+	is.Equal(resp1.Echo, 1)
+	is.Equal(resp2.Echo, 2)
+}
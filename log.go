@@ -0,0 +1,161 @@
+package graphql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// LogPhase tells which step of a request a LogEntry describes.
+type LogPhase string
+
+const (
+	// LogPhaseRequest is logged when a request is sent to the server.
+	LogPhaseRequest LogPhase = "request"
+	// LogPhaseResponse is logged when the response has been read, or
+	// when sending the request failed.
+	LogPhaseResponse LogPhase = "response"
+)
+
+// LogEntry describes an HTTP request made by the client, or its response.
+type LogEntry struct {
+	Phase  LogPhase
+	Method string
+	URL    string
+	// Bytes is the size of the request body for LogPhaseRequest, or -1
+	// for an upload of unknown size, and of the response body, after
+	// decompression, for LogPhaseResponse.
+	Bytes int
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Duration is the time elapsed since the request was sent, until the
+	// whole response body was read.
+	Duration time.Duration
+	// Err is the error that ended the request, if any.
+	Err error
+}
+
+// WithStructuredLog calls fn when each HTTP request is sent and when its
+// response has been read, including the timing of the round trip.
+// Each retry attempt is logged separately. Client.Log keeps working
+// alongside.
+//  NewClient(endpoint, WithStructuredLog(func(e graphql.LogEntry) {
+//      if e.Phase == graphql.LogPhaseResponse {
+//          metrics.Observe(e.Duration)
+//      }
+//  }))
+func WithStructuredLog(fn func(LogEntry)) ClientOption {
+	return func(client *Client) {
+		client.structuredLog = fn
+	}
+}
+
+func (c *Client) logEntry(entry LogEntry) {
+	if c.structuredLog != nil {
+		c.structuredLog(entry)
+	}
+}
+
+// WithLogger calls fn with the same debug information as Client.Log,
+// along with the context of the request, from which RequestID gets the
+// ID of the request and fn can take its own values, such as a trace ID.
+// The messages given to fn are not prefixed with the ID. Client.Log
+// keeps working alongside.
+//  NewClient(endpoint, WithLogger(func(ctx context.Context, s string) {
+//      log.Printf("%s %s", graphql.RequestID(ctx), s)
+//  }))
+func WithLogger(fn func(ctx context.Context, s string)) ClientOption {
+	return func(client *Client) {
+		client.logger = fn
+	}
+}
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying id as the ID of the
+// requests run with it, which the client logs instead of generating one.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID gets the ID of the request carried by ctx, set with
+// ContextWithRequestID or generated by the client, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID makes sure ctx carries a request ID, generating a random
+// one when it has none.
+func withRequestID(ctx context.Context) context.Context {
+	if RequestID(ctx) != "" {
+		return ctx
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ctx
+	}
+	return ContextWithRequestID(ctx, hex.EncodeToString(b))
+}
+
+// WithLogRedaction sets the function that replaces the values of request
+// headers and variables in what the client logs with Log, instead of
+// DefaultLogRedaction. fn is called with the name of each header or
+// top-level variable and its value, and returns the value to log. The
+// values sent to the server are not changed. A nil fn logs the values
+// as they are.
+//  NewClient(endpoint, WithLogRedaction(func(key string, value interface{}) interface{} {
+//      if key == "password" {
+//          return "[REDACTED]"
+//      }
+//      return graphql.DefaultLogRedaction(key, value)
+//  }))
+func WithLogRedaction(fn func(key string, value interface{}) interface{}) ClientOption {
+	if fn == nil {
+		fn = func(key string, value interface{}) interface{} { return value }
+	}
+	return func(client *Client) {
+		client.logRedaction = fn
+	}
+}
+
+// DefaultLogRedaction redacts the values of the Authorization, Cookie and
+// X-API-Key headers, and of variables of the same name.
+func DefaultLogRedaction(key string, value interface{}) interface{} {
+	switch http.CanonicalHeaderKey(key) {
+	case "Authorization", "Cookie", "X-Api-Key":
+		return "[REDACTED]"
+	}
+	return value
+}
+
+// redactHeader gets a copy of header to log. The header set with
+// WithAPIKey is always redacted.
+func (c *Client) redactHeader(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		for _, value := range values {
+			if key == c.apiKeyHeader {
+				redacted[key] = append(redacted[key], "[REDACTED]")
+				continue
+			}
+			redacted[key] = append(redacted[key], fmt.Sprint(c.logRedaction(key, value)))
+		}
+	}
+	return redacted
+}
+
+// redactVariables gets a copy of vars to log.
+func (c *Client) redactVariables(vars map[string]interface{}) map[string]interface{} {
+	if vars == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(vars))
+	for key, value := range vars {
+		redacted[key] = c.logRedaction(key, value)
+	}
+	return redacted
+}
@@ -0,0 +1,35 @@
+package graphql
+
+import "time"
+
+// Metrics collects metrics about the requests made by a client, for
+// example to export them to Prometheus.
+type Metrics interface {
+	// ObserveRequest is called at the end of every run with the name of
+	// the operation, or "anonymous", how long the run took, including
+	// retries, and the error it returned, if any.
+	ObserveRequest(op string, dur time.Duration, err error)
+}
+
+// nopMetrics is the Metrics of clients without WithMetrics.
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveRequest(string, time.Duration, error) {}
+
+// WithMetrics reports every run of the client to m.
+func WithMetrics(m Metrics) ClientOption {
+	return func(client *Client) {
+		if m == nil {
+			m = nopMetrics{}
+		}
+		client.metrics = m
+	}
+}
+
+// metricsOperation gets the operation label of the request.
+func metricsOperation(req *Request) string {
+	if name := req.OperationName(); name != "" {
+		return name
+	}
+	return "anonymous"
+}
@@ -0,0 +1,43 @@
+package graphql
+
+import "context"
+
+// RunFunc runs a request and unmarshals the data of the response into
+// resp, like Client.Run.
+type RunFunc func(ctx context.Context, req *Request, resp interface{}) error
+
+// Middleware wraps a RunFunc to add behaviour around it, such as
+// logging, metrics or caching. It may return without calling next to
+// short-circuit the request.
+type Middleware func(next RunFunc) RunFunc
+
+// WithMiddleware adds middleware around every run of the client.
+// Middleware is applied in the order it is added, the first one being
+// the outermost.
+//  NewClient(endpoint, WithMiddleware(func(next graphql.RunFunc) graphql.RunFunc {
+//      return func(ctx context.Context, req *graphql.Request, resp interface{}) error {
+//          start := time.Now()
+//          err := next(ctx, req, resp)
+//          log.Println(req.Query(), time.Since(start))
+//          return err
+//      }
+//  }))
+func WithMiddleware(fn Middleware) ClientOption {
+	return func(client *Client) {
+		client.middleware = append(client.middleware, fn)
+	}
+}
+
+// chain builds the RunFunc running gr through the middleware of the
+// client. The response object handed down the chain becomes the data
+// target of gr.
+func (c *Client) chain(gr *graphResponse) RunFunc {
+	next := RunFunc(func(ctx context.Context, req *Request, resp interface{}) error {
+		gr.Data = resp
+		return c.execute(ctx, req, gr)
+	})
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		next = c.middleware[i](next)
+	}
+	return next
+}
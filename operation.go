@@ -0,0 +1,260 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// operation is an operation definition found in a query document.
+type operation struct {
+	// typ is query, mutation or subscription.
+	typ string
+	// name is empty for anonymous operations.
+	name string
+	// variables is the source of the variable definitions, without
+	// the parentheses.
+	variables string
+}
+
+// parseOperations finds the operation definitions of a query document.
+// It is a tolerant scanner rather than a full parser: it only looks at
+// the top level of the document and skips comments, strings, variable
+// definitions and selection sets.
+func parseOperations(q string) []operation {
+	var (
+		ops        []operation
+		braces     int
+		parens     int
+		inHeader   bool
+		expectName bool
+		// varsStart is the start of the variable definitions of the last
+		// operation while they are being scanned
+		varsStart = -1
+		// inOperation is set in the header of an operation, as opposed to
+		// the header of a fragment, until its directives
+		inOperation bool
+	)
+	for i := 0; i < len(q); i++ {
+		ch := q[i]
+		switch {
+		case ch == '#':
+			for i < len(q) && q[i] != '\n' {
+				i++
+			}
+		case ch == '"':
+			i = skipString(q, i)
+		case ch == '(':
+			if parens == 0 && braces == 0 && inOperation {
+				varsStart = i + 1
+				inOperation = false
+			}
+			parens++
+			expectName = false
+		case ch == ')':
+			if parens > 0 {
+				parens--
+			}
+			if parens == 0 && varsStart >= 0 {
+				ops[len(ops)-1].variables = q[varsStart:i]
+				varsStart = -1
+			}
+		case ch == '{' && parens == 0:
+			if braces == 0 {
+				if !inHeader {
+					ops = append(ops, operation{typ: "query"})
+				}
+				inHeader = false
+				inOperation = false
+				expectName = false
+			}
+			braces++
+		case ch == '}' && parens == 0:
+			if braces > 0 {
+				braces--
+			}
+		case isNameStart(ch):
+			start := i
+			for i+1 < len(q) && isNameContinue(q[i+1]) {
+				i++
+			}
+			if braces > 0 || parens > 0 {
+				continue
+			}
+			name := q[start : i+1]
+			if expectName {
+				ops[len(ops)-1].name = name
+				expectName = false
+				continue
+			}
+			if inHeader {
+				continue
+			}
+			switch name {
+			case "query", "mutation", "subscription":
+				ops = append(ops, operation{typ: name})
+				inHeader = true
+				inOperation = true
+				expectName = true
+			case "fragment":
+				inHeader = true
+			}
+		default:
+			if parens == 0 && braces == 0 && ch == '@' {
+				expectName = false
+				inOperation = false
+			}
+		}
+	}
+	return ops
+}
+
+// skipString returns the index of the closing quote of the string
+// literal starting at i, handling both regular and block strings.
+func skipString(q string, i int) int {
+	if len(q) >= i+3 && q[i:i+3] == `"""` {
+		for j := i + 3; j+2 < len(q); j++ {
+			if q[j] == '\\' && len(q) >= j+4 && q[j+1:j+4] == `"""` {
+				j += 3
+				continue
+			}
+			if q[j:j+3] == `"""` {
+				return j + 2
+			}
+		}
+		return len(q)
+	}
+	for j := i + 1; j < len(q); j++ {
+		switch q[j] {
+		case '\\':
+			j++
+		case '"', '\n':
+			return j
+		}
+	}
+	return len(q)
+}
+
+func isNameStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isNameContinue(ch byte) bool {
+	return isNameStart(ch) || (ch >= '0' && ch <= '9')
+}
+
+// variable is a variable definition of an operation.
+type variable struct {
+	name string
+	// typ is the type of the variable as written in the query.
+	typ        string
+	hasDefault bool
+}
+
+// required reports whether the variable must be given a value.
+func (v variable) required() bool {
+	return strings.HasSuffix(v.typ, "!") && !v.hasDefault
+}
+
+// parseVariables parses the variable definitions of an operation, as
+// found in operation.variables.
+func parseVariables(defs string) []variable {
+	var (
+		vars  []variable
+		depth int
+		// typeDone is set once the type of the last variable is complete
+		typeDone bool
+	)
+	for i := 0; i < len(defs); i++ {
+		ch := defs[i]
+		switch {
+		case ch == '#':
+			for i < len(defs) && defs[i] != '\n' {
+				i++
+			}
+		case ch == '"':
+			i = skipString(defs, i)
+			typeDone = true
+		case ch == '$' && depth == 0:
+			start := i + 1
+			for i+1 < len(defs) && isNameContinue(defs[i+1]) {
+				i++
+			}
+			vars = append(vars, variable{name: defs[start : i+1]})
+			for i+1 < len(defs) && defs[i+1] != ':' {
+				i++
+			}
+			i++
+			typeDone = false
+		case len(vars) == 0:
+		case ch == '=' && depth == 0:
+			vars[len(vars)-1].hasDefault = true
+			typeDone = true
+		case ch == '@' && depth == 0:
+			typeDone = true
+		case ch == '(' || ch == '{':
+			depth++
+			typeDone = true
+		case ch == ')' || ch == '}':
+			if depth > 0 {
+				depth--
+			}
+		case !typeDone && depth == 0:
+			switch ch {
+			case ' ', '\t', '\n', '\r', ',':
+			default:
+				vars[len(vars)-1].typ += string(ch)
+			}
+		}
+	}
+	return vars
+}
+
+// operation gets the operation that will be executed for the request:
+// the operation named by OpName or otherwise the first operation in the
+// document.
+func (req *Request) operation() (operation, bool) {
+	for _, op := range parseOperations(req.q) {
+		if req.OpName == "" || op.name == req.OpName {
+			return op, true
+		}
+	}
+	return operation{}, false
+}
+
+// operationType gets the type of the operation that will be executed
+// for the request.
+// It returns an empty string when the operation can't be found.
+func (req *Request) operationType() string {
+	op, _ := req.operation()
+	return op.typ
+}
+
+// OperationName gets the name of the operation executed for the request:
+// OpName when set, or otherwise the name of the first operation of the
+// query, as in "query Hero($episode: Episode)". It returns an empty
+// string for anonymous operations.
+// It is meant for labelling requests in logs, metrics and traces.
+func (req *Request) OperationName() string {
+	if req.OpName != "" {
+		return req.OpName
+	}
+	op, _ := req.operation()
+	return op.name
+}
+
+// checkVariables checks that the request has a value for every non-null
+// variable without a default value declared by its operation. Variables
+// in files are given a file of the request.
+func (req *Request) checkVariables(files map[string]bool) error {
+	op, ok := req.operation()
+	if !ok {
+		return nil
+	}
+	vars := req.variableMap()
+	for _, v := range parseVariables(op.variables) {
+		if v.required() && vars[v.name] == nil && !files[v.name] {
+			return fmt.Errorf("graphql: missing value for variable $%s of type %s", v.name, v.typ)
+		}
+	}
+	return nil
+}
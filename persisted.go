@@ -0,0 +1,126 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// WithPersistedQueries enables Apollo Automatic Persisted Queries.
+// Requests are first sent with only the SHA-256 hash of the query in
+// extensions.persistedQuery; when the server doesn't know the hash yet,
+// the request is sent again with the full query so the server can
+// register it.
+// Requests carrying files, and all requests of clients using
+// UseMultipartForm, are sent with the full query.
+// Requests with a document ID are sent with only the ID.
+func WithPersistedQueries() ClientOption {
+	return func(client *Client) {
+		client.persistedQueries = true
+	}
+}
+
+func (c *Client) runPersistedQuery(ctx context.Context, req *Request, gr *graphResponse) error {
+	req.extensions = map[string]interface{}{
+		"persistedQuery": map[string]interface{}{
+			"version":    1,
+			"sha256Hash": req.queryHash(),
+		},
+	}
+	req.omitQuery = true
+	defer func() {
+		req.extensions = nil
+		req.omitQuery = false
+	}()
+	err := c.dispatch(ctx, req, gr)
+	if !isPersistedQueryNotFound(err) {
+		return err
+	}
+	c.logf(ctx, ">> persisted query not found, sending query")
+	req.omitQuery = false
+	gr.Errors = nil
+	return c.dispatch(ctx, req, gr)
+}
+
+// queryHash gets the hex encoded SHA-256 hash of the query, computing it
+// only once for the same query.
+func (req *Request) queryHash() string {
+	if req.hash == "" || req.hashedQuery != req.q {
+		sum := sha256.Sum256([]byte(req.q))
+		req.hash = hex.EncodeToString(sum[:])
+		req.hashedQuery = req.q
+	}
+	return req.hash
+}
+
+// isPersistedQueryNotFound reports whether err tells that the server
+// can't execute the request from the query hash alone.
+func isPersistedQueryNotFound(err error) bool {
+	var errs Errors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	for _, e := range errs {
+		switch e.Message {
+		case "PersistedQueryNotFound", "PersistedQueryNotSupported":
+			return true
+		}
+	}
+	return errs.HasExtensionCode("PERSISTED_QUERY_NOT_FOUND") ||
+		errs.HasExtensionCode("PERSISTED_QUERY_NOT_SUPPORTED")
+}
+
+// SetDocumentID sets the ID of the trusted document, or persisted
+// operation, holding the query of the request. The request is then sent
+// with documentId instead of the query, which can be left empty.
+//  req := graphql.NewRequest("")
+//  req.SetDocumentID("a1b2c3")
+func (req *Request) SetDocumentID(id string) {
+	req.documentID = id
+}
+
+// DocumentID gets the ID of the trusted document set with SetDocumentID.
+func (req *Request) DocumentID() string {
+	return req.documentID
+}
+
+// WithTrustedDocuments sends every request as the ID of its trusted
+// document instead of its query, for servers that only execute known
+// documents. manifest maps each document ID to its query, as produced
+// by the build. The ID of a request without SetDocumentID is found from
+// its query, and the query of a request with only a document ID is taken
+// from the manifest. Requests whose query is not in the manifest, or
+// doesn't match the document of their ID, fail without being sent.
+func WithTrustedDocuments(manifest map[string]string) ClientOption {
+	return func(client *Client) {
+		client.trustedDocuments = make(map[string]string, len(manifest))
+		client.trustedDocumentIDs = make(map[string]string, len(manifest))
+		for id, query := range manifest {
+			client.trustedDocuments[id] = query
+			client.trustedDocumentIDs[query] = id
+		}
+	}
+}
+
+// resolveDocument sets the document ID and query of the run copy of
+// a request from the trusted documents of the client.
+func (c *Client) resolveDocument(req *Request) error {
+	if c.trustedDocuments == nil {
+		return nil
+	}
+	id, q := req.documentID, req.q
+	switch {
+	case id == "":
+		var ok bool
+		if req.documentID, ok = c.trustedDocumentIDs[q]; !ok {
+			return errors.New("graphql: query is not a trusted document")
+		}
+	case q == "":
+		req.q = c.trustedDocuments[id]
+	case c.trustedDocuments[id] != q:
+		return errors.Errorf("graphql: query doesn't match trusted document %q", id)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package graphql
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// progressInterval is the least time between two reports of progress.
+const progressInterval = 100 * time.Millisecond
+
+// WithProgress calls fn while the body of each request is sent, with
+// the number of bytes sent so far and the size of the body, which is -1
+// for uploads with files of unknown size. A file has a known size when
+// its reader is an *os.File or an io.Seeker such as *bytes.Reader.
+// fn is called at most every 100 milliseconds, and once the whole body
+// has been sent, possibly from another goroutine. Each retry attempt
+// starts over.
+//  NewClient(endpoint, UseMultipartRequestSpec(), WithProgress(func(sent, total int64) {
+//      if total > 0 {
+//          bar.Set(float64(sent) / float64(total))
+//      }
+//  }))
+func WithProgress(fn func(bytesTransferred, totalBytes int64)) ClientOption {
+	return func(client *Client) {
+		client.uploadProgress = fn
+	}
+}
+
+// WithDownloadProgress calls fn while the body of each response is
+// read, like WithProgress does for requests. The size of the body is
+// taken from its Content-Length header, and is -1 without it. Bytes
+// are counted as received, before decompression.
+func WithDownloadProgress(fn func(bytesTransferred, totalBytes int64)) ClientOption {
+	return func(client *Client) {
+		client.downloadProgress = fn
+	}
+}
+
+// progressBody reports the progress of reading a body.
+type progressBody struct {
+	io.ReadCloser
+	fn    func(bytesTransferred, totalBytes int64)
+	total int64
+	n     int64
+	last  time.Time
+	done  bool
+}
+
+// withProgress wraps body to report its progress to fn, unless fn or
+// body is nil.
+func withProgress(body io.ReadCloser, total int64, fn func(bytesTransferred, totalBytes int64)) io.ReadCloser {
+	if fn == nil || body == nil || body == http.NoBody {
+		return body
+	}
+	return &progressBody{ReadCloser: body, fn: fn, total: total, last: time.Now()}
+}
+
+func (p *progressBody) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	p.n += int64(n)
+	if p.done {
+		return n, err
+	}
+	now := time.Now()
+	switch {
+	case err == io.EOF || (p.total >= 0 && p.n >= p.total):
+		p.done = true
+		p.fn(p.n, p.total)
+	case n > 0 && now.Sub(p.last) >= progressInterval:
+		p.last = now
+		p.fn(p.n, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,233 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// QueryBuilder builds a query selecting a field, with its arguments and
+// its own selection set, to pass to NewRequest:
+//  q, err := graphql.NewQueryBuilder("items").
+//      Var("key", "ID!").
+//      Arg("id", "$key").
+//      Select("field1", "field2").
+//      Build()
+//  // query ($key: ID!) { items(id: $key) { field1 field2 } }
+// Builders of nested fields are added with SelectField.
+type QueryBuilder struct {
+	field     string
+	operation string
+	name      string
+	vars      []builderPair
+	args      []builderPair
+	selection []interface{}
+}
+
+// builderPair is a variable definition or an argument.
+type builderPair struct {
+	name  string
+	value interface{}
+}
+
+// NewQueryBuilder makes a QueryBuilder selecting field, which may be
+// given an alias as in "first: items".
+func NewQueryBuilder(field string) *QueryBuilder {
+	return &QueryBuilder{field: field, operation: "query"}
+}
+
+// Operation sets the type of the operation, query unless changed, and
+// its name, which may be empty.
+func (b *QueryBuilder) Operation(typ, name string) *QueryBuilder {
+	b.operation = typ
+	b.name = name
+	return b
+}
+
+// Var declares the variable $name of the given type, such as "ID!", on
+// the operation.
+func (b *QueryBuilder) Var(name, typ string) *QueryBuilder {
+	b.vars = append(b.vars, builderPair{name: strings.TrimPrefix(name, "$"), value: typ})
+	return b
+}
+
+// Arg adds an argument to the field. Strings starting with $ refer to
+// variables, and other values are written as GraphQL literals: strings,
+// numbers, booleans, nil, slices, arrays and maps with string keys, or
+// pointers to them. Build fails for values of other types, such as
+// structs.
+func (b *QueryBuilder) Arg(name string, value interface{}) *QueryBuilder {
+	b.args = append(b.args, builderPair{name: name, value: value})
+	return b
+}
+
+// Select adds fields without arguments or selections to the selection
+// set of the field.
+func (b *QueryBuilder) Select(fields ...string) *QueryBuilder {
+	for _, field := range fields {
+		b.selection = append(b.selection, field)
+	}
+	return b
+}
+
+// SelectField adds the field built by sub to the selection set of the
+// field. The variables declared by sub are declared on the operation.
+func (b *QueryBuilder) SelectField(sub *QueryBuilder) *QueryBuilder {
+	b.selection = append(b.selection, sub)
+	return b
+}
+
+// Build gets the query, or an error when an argument has a value that
+// can't be written as a GraphQL literal.
+func (b *QueryBuilder) Build() (string, error) {
+	var sb strings.Builder
+	sb.WriteString(b.operation)
+	if b.name != "" {
+		sb.WriteString(" ")
+		sb.WriteString(b.name)
+	}
+	if vars := b.allVars(nil); len(vars) > 0 {
+		sb.WriteString(" (")
+		for i, v := range vars {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "$%s: %s", v.name, v.value)
+		}
+		sb.WriteString(")")
+	}
+	sb.WriteString(" { ")
+	if err := b.writeField(&sb); err != nil {
+		return "", err
+	}
+	sb.WriteString(" }")
+	return sb.String(), nil
+}
+
+// allVars gets the variables declared by the builder and the builders
+// of its selection, in order.
+func (b *QueryBuilder) allVars(vars []builderPair) []builderPair {
+	vars = append(vars, b.vars...)
+	for _, s := range b.selection {
+		if sub, ok := s.(*QueryBuilder); ok {
+			vars = sub.allVars(vars)
+		}
+	}
+	return vars
+}
+
+func (b *QueryBuilder) writeField(sb *strings.Builder) error {
+	sb.WriteString(b.field)
+	if len(b.args) > 0 {
+		sb.WriteString("(")
+		for i, arg := range b.args {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(arg.name)
+			sb.WriteString(": ")
+			if err := writeValue(sb, arg.value); err != nil {
+				return errors.Wrapf(err, "graphql: argument %s of %s", arg.name, b.field)
+			}
+		}
+		sb.WriteString(")")
+	}
+	if len(b.selection) == 0 {
+		return nil
+	}
+	sb.WriteString(" {")
+	for _, s := range b.selection {
+		sb.WriteString(" ")
+		switch s := s.(type) {
+		case string:
+			sb.WriteString(s)
+		case *QueryBuilder:
+			if err := s.writeField(sb); err != nil {
+				return err
+			}
+		}
+	}
+	sb.WriteString(" }")
+	return nil
+}
+
+// writeValue writes v as a GraphQL value. Values of other kinds than
+// strings, numbers, booleans, slices, arrays and maps with string keys,
+// or pointers to them, are not supported.
+func writeValue(sb *strings.Builder, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		sb.WriteString("null")
+		return nil
+	case json.Number:
+		sb.WriteString(v.String())
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			sb.WriteString("null")
+			return nil
+		}
+		return writeValue(sb, rv.Elem().Interface())
+	case reflect.String:
+		s := rv.String()
+		if strings.HasPrefix(s, "$") {
+			sb.WriteString(s)
+			return nil
+		}
+		// JSON strings are valid GraphQL strings
+		b, _ := json.Marshal(s)
+		sb.Write(b)
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value %v", v)
+		}
+		sb.Write(b)
+	case reflect.Slice, reflect.Array:
+		sb.WriteString("[")
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			if err := writeValue(sb, rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		sb.WriteString("]")
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return errors.Errorf("unsupported map key type %s", rv.Type().Key())
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, key := range rv.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		sb.WriteString("{")
+		for i, key := range keys {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(key)
+			sb.WriteString(": ")
+			value := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+			if err := writeValue(sb, value.Interface()); err != nil {
+				return err
+			}
+		}
+		sb.WriteString("}")
+	default:
+		return errors.Errorf("unsupported value of type %T", v)
+	}
+	return nil
+}
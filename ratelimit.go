@@ -0,0 +1,76 @@
+package graphql
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// WithRateLimit limits the requests sent by the client to rps per second
+// on average, allowing bursts of up to burst requests, with a token
+// bucket shared by all the goroutines using the client. Each HTTP request
+// sent by Run, RunBatch and the like, including retries, waits for a
+// token; when ctx is done first, the run fails with the error of ctx.
+// Streams and subscriptions are not limited.
+func WithRateLimit(rps float64, burst int) ClientOption {
+	return func(client *Client) {
+		if rps <= 0 {
+			client.rateLimiter = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		client.rateLimiter = &rateLimiter{
+			rps:    rps,
+			burst:  float64(burst),
+			tokens: float64(burst),
+			last:   time.Now(),
+		}
+	}
+}
+
+// rateLimiter is a token bucket.
+type rateLimiter struct {
+	rps   float64
+	burst float64
+
+	mu sync.Mutex
+	// tokens is negative when requests are waiting for tokens
+	tokens float64
+	last   time.Time
+}
+
+// wait takes a token, waiting until one is available or ctx is done.
+// A nil limiter never waits.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rps)
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rps * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// give the token back to the next requests
+		l.mu.Lock()
+		l.tokens = math.Min(l.burst, l.tokens+1)
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
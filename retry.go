@@ -0,0 +1,270 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// retryPolicy describes when and how often failed requests are retried.
+type retryPolicy struct {
+	maxAttempts int
+	// budget limits the time spent on all the attempts of a request
+	budget      time.Duration
+	backoff     func(attempt int) time.Duration
+	statusCodes map[int]bool
+	// errorCodes are the extensions.code of the GraphQL errors retried
+	errorCodes map[string]bool
+	uploads    bool
+}
+
+// defaultRetryStatusCodes are the HTTP status codes retried when
+// WithRetryStatusCodes is not used.
+var defaultRetryStatusCodes = map[int]bool{
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// WithRetry retries requests that fail with a network error or with
+// a retryable HTTP status code (502, 503 and 504 unless changed with
+// WithRetryStatusCodes), making at most maxAttempts attempts in total.
+// The backoff function returns how long to wait before the next attempt,
+// where attempt is the number of the attempt that just failed; a nil
+// backoff retries immediately.
+// Requests carrying files are not retried unless WithRetryUploads is used.
+//  NewClient(endpoint, WithRetry(3, func(attempt int) time.Duration {
+//      return time.Duration(attempt) * 100 * time.Millisecond
+//  }))
+func WithRetry(maxAttempts int, backoff func(attempt int) time.Duration) ClientOption {
+	return func(client *Client) {
+		client.retry.maxAttempts = maxAttempts
+		client.retry.backoff = backoff
+	}
+}
+
+// WithRetryBudget limits the total time spent sending a request and
+// retrying it: no attempt is started once the time elapsed since the
+// first attempt, plus the backoff before the next one, would exceed
+// total. An attempt in progress is not interrupted; use WithTimeout for
+// that.
+// It combines with the number of attempts set with WithRetry, and
+// without WithRetry requests are retried as often as the budget allows.
+// Without a backoff function, attempts are spaced by an exponential
+// backoff with jitter, starting around 50ms and doubling up to 5s.
+//  NewClient(endpoint,
+//      WithRetry(10, backoff),
+//      WithRetryBudget(5*time.Second),
+//  )
+func WithRetryBudget(total time.Duration) ClientOption {
+	return func(client *Client) {
+		client.retry.budget = total
+	}
+}
+
+// WithRetryStatusCodes sets the HTTP status codes that WithRetry treats
+// as transient failures.
+func WithRetryStatusCodes(codes ...int) ClientOption {
+	return func(client *Client) {
+		client.retry.statusCodes = make(map[int]bool, len(codes))
+		for _, code := range codes {
+			client.retry.statusCodes[code] = true
+		}
+	}
+}
+
+// WithRetryableErrorCodes makes WithRetry retry responses whose GraphQL
+// errors all have one of the codes in their extensions.code, such as
+// RATE_LIMITED. A response with any other error, like BAD_USER_INPUT,
+// is not retried. By default GraphQL errors are never retried.
+func WithRetryableErrorCodes(codes ...string) ClientOption {
+	return func(client *Client) {
+		client.retry.errorCodes = make(map[string]bool, len(codes))
+		for _, code := range codes {
+			client.retry.errorCodes[code] = true
+		}
+	}
+}
+
+// WithRetryUploads allows WithRetry to retry requests carrying files.
+// Only use it when the file readers can be sent more than once.
+func WithRetryUploads() ClientOption {
+	return func(client *Client) {
+		client.retry.uploads = true
+	}
+}
+
+// WithReplayableBody allows WithRetry to retry requests carrying files,
+// like WithRetryUploads, by reading each file once and keeping its
+// content for the next attempts: in memory up to 8 MiB, and above that
+// in a temporary file removed once the request is done. The body is
+// still streamed to the server on every attempt.
+func WithReplayableBody() ClientOption {
+	return func(client *Client) {
+		client.retry.uploads = true
+		client.replayMemoryLimit = defaultReplayMemoryLimit
+	}
+}
+
+// RetryError is returned when a request still fails after being retried.
+type RetryError struct {
+	// Attempt is the number of the attempt that failed last.
+	Attempt int
+	// Err is the error of the last attempt.
+	Err error
+}
+
+// Error implements error interface
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("graphql: attempt %d failed: %v", e.Attempt, e.Err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// retryError wraps err in a RetryError when it is the error of
+// the last of several attempts.
+func retryError(failedAttempt int, err error) error {
+	if failedAttempt > 0 {
+		return &RetryError{Attempt: failedAttempt, Err: err}
+	}
+	return err
+}
+
+// attempts gets the number of attempts allowed for the request.
+func (p retryPolicy) attempts(req *Request) int {
+	if len(req.files) > 0 && !p.uploads {
+		return 1
+	}
+	if p.maxAttempts < 1 {
+		if p.budget > 0 {
+			// only limited by the budget
+			return math.MaxInt32
+		}
+		return 1
+	}
+	return p.maxAttempts
+}
+
+// retryable reports whether the outcome of an attempt is worth retrying.
+func (p retryPolicy) retryable(ctx context.Context, res *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		// only failing to reach the server or to read its response is
+		// transient, the server or the client would fail the same way
+		// again otherwise
+		var netErr *NetworkError
+		return errors.As(err, &netErr)
+	}
+	statusCodes := p.statusCodes
+	if statusCodes == nil {
+		statusCodes = defaultRetryStatusCodes
+	}
+	return statusCodes[res.StatusCode]
+}
+
+// retryableErrors reports whether the response carries GraphQL errors
+// that all have a code set with WithRetryableErrorCodes.
+func (c *Client) retryableErrors(ctx context.Context, body []byte, err error) bool {
+	if len(c.retry.errorCodes) == 0 || err != nil || ctx.Err() != nil {
+		return false
+	}
+	var result struct {
+		Errors Errors
+	}
+	if err := json.Unmarshal(c.standardKeys(body), &result); err != nil || len(result.Errors) == 0 {
+		return false
+	}
+	for _, e := range result.Errors {
+		if !c.retry.errorCodes[e.Code()] {
+			return false
+		}
+	}
+	return true
+}
+
+// budgetBackoff is the backoff of WithRetryBudget without a backoff
+// function: 50ms doubling after every attempt up to 5s, of which a random
+// half is waited.
+func budgetBackoff(attempt int) time.Duration {
+	d := 5 * time.Second
+	if attempt < 8 {
+		d = 50 * time.Millisecond << uint(attempt-1)
+		if d > 5*time.Second {
+			d = 5 * time.Second
+		}
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// send sends the request, retrying transient failures according to
+// the retry policy of the client.
+// When the last allowed attempt failed in a retryable way, failedAttempt
+// is the number of that attempt.
+func (c *Client) send(ctx context.Context, req *Request, header http.Header) (res *http.Response, body []byte, failedAttempt int, err error) {
+	probe, err := c.breaker.allow()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer func() {
+		c.breaker.record(probe, circuitResultOf(ctx, res, err))
+	}()
+	maxAttempts := c.retry.attempts(req)
+	if maxAttempts > 1 {
+		// every attempt sends the same body
+		if c.replayMemoryLimit > 0 && req.writeBody != nil {
+			err = req.bufferFiles(ctx, c.replayMemoryLimit)
+		} else {
+			err = req.bufferBody(ctx)
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	reqBody := req.body.Bytes()
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		if err := c.rateLimiter.wait(ctx); err != nil {
+			return nil, nil, 0, err
+		}
+		res, body, err = c.roundTrip(ctx, req, header, reqBody)
+		retry := c.retry.retryable(ctx, res, err) || c.retryableErrors(ctx, body, err)
+		if maxAttempts == 1 || !retry {
+			return res, body, 0, err
+		}
+		if attempt >= maxAttempts {
+			return res, body, attempt, err
+		}
+		var wait time.Duration
+		switch {
+		case c.retry.backoff != nil:
+			wait = c.retry.backoff(attempt)
+		case c.retry.budget > 0:
+			wait = budgetBackoff(attempt)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return res, body, attempt, err
+		}
+		if c.retry.budget > 0 && time.Since(start)+wait > c.retry.budget {
+			return res, body, attempt, err
+		}
+		c.logf(ctx, ">> retrying after attempt %d in %v", attempt, wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return res, body, attempt, err
+		case <-timer.C:
+		}
+	}
+}
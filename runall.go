@@ -0,0 +1,54 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+)
+
+// RunJob is a request run by RunAll, with the response object its data
+// is unmarshalled into. A nil Response skips parsing of the data.
+type RunJob struct {
+	Request  *Request
+	Response interface{}
+}
+
+// WithRunAllConcurrency limits the number of requests RunAll runs at
+// the same time. By default all the jobs run at once.
+func WithRunAllConcurrency(n int) ClientOption {
+	return func(client *Client) {
+		client.runAllConcurrency = n
+	}
+}
+
+// RunAll runs the requests of the jobs concurrently, each in its own
+// HTTP request, as limited by WithRunAllConcurrency. Unlike RunBatch,
+// each request goes through Run, with its middleware, retries and so on.
+// The returned slice holds the error of each job, nil when it succeeded.
+// Once ctx is done the jobs not started yet fail with the error of ctx.
+func (c *Client) RunAll(ctx context.Context, jobs []RunJob) []error {
+	errs := make([]error, len(jobs))
+	limit := c.runAllConcurrency
+	if limit < 1 || limit > len(jobs) {
+		limit = len(jobs)
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			errs[i] = contextError(ctx, err)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, job RunJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = c.Run(ctx, job.Request, job.Response)
+		}(i, job)
+	}
+	wg.Wait()
+	return errs
+}
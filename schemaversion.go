@@ -0,0 +1,113 @@
+package graphql
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// defaultSchemaVersionHeader is the response header holding the schema
+// version when WithSchemaVersionHeader is not used.
+const defaultSchemaVersionHeader = "X-Schema-Version"
+
+// WithExpectedSchemaVersion makes the client compare the schema version
+// reported by the server in a response header, X-Schema-Version unless
+// changed with WithSchemaVersionHeader, with version.
+// The check is soft: the response reporting another version is returned
+// as usual, and the requests run afterwards fail with a
+// SchemaVersionError without being sent, until ResetSchemaVersion is
+// called. Responses without the header are not checked, and an empty
+// version disables the check.
+func WithExpectedSchemaVersion(version string) ClientOption {
+	return func(client *Client) {
+		client.schemaVersionCheck().expected = version
+	}
+}
+
+// WithSchemaVersionHeader sets the response header that
+// WithExpectedSchemaVersion reads the schema version from.
+func WithSchemaVersionHeader(name string) ClientOption {
+	return func(client *Client) {
+		client.schemaVersionCheck().header = name
+	}
+}
+
+func (c *Client) schemaVersionCheck() *schemaVersionCheck {
+	if c.schemaVersion == nil {
+		c.schemaVersion = &schemaVersionCheck{header: defaultSchemaVersionHeader}
+	}
+	return c.schemaVersion
+}
+
+// ResetSchemaVersion forgets the schema version mismatch reported by an
+// earlier response, so requests are sent again, for example once the
+// client has been checked against the new schema. A later response
+// reporting another version than the expected one fails the requests
+// again.
+func (c *Client) ResetSchemaVersion() {
+	c.schemaVersion.reset()
+}
+
+// SchemaVersionError is returned by clients using WithExpectedSchemaVersion
+// once the server reported a schema version other than the expected one.
+type SchemaVersionError struct {
+	// Expected is the schema version the client was built against.
+	Expected string
+	// Actual is the schema version reported by the server.
+	Actual string
+}
+
+// Error implements error interface
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("graphql: server schema version %q does not match expected version %q", e.Actual, e.Expected)
+}
+
+// schemaVersionCheck holds the expected schema version, and the mismatch
+// once a response reported another one.
+type schemaVersionCheck struct {
+	expected string
+	header   string
+
+	mu       sync.Mutex
+	mismatch *SchemaVersionError
+}
+
+// err gets the mismatch reported by an earlier response, if any.
+func (s *schemaVersionCheck) err() error {
+	if s == nil || s.expected == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mismatch == nil {
+		return nil
+	}
+	return s.mismatch
+}
+
+// reset forgets the mismatch.
+func (s *schemaVersionCheck) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mismatch = nil
+}
+
+// observe records a mismatch when the response header reports a schema
+// version other than the expected one.
+func (s *schemaVersionCheck) observe(header http.Header) {
+	if s == nil || s.expected == "" {
+		return
+	}
+	actual := header.Get(s.header)
+	if actual == "" || actual == s.expected {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mismatch == nil {
+		s.mismatch = &SchemaVersionError{Expected: s.expected, Actual: actual}
+	}
+}
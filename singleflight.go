@@ -0,0 +1,100 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// WithSingleflight coalesces identical queries running concurrently
+// into a single HTTP request whose response is decoded for each caller.
+// Queries are identical when they have the same encoded body, such as
+// the same query, variables and operation name, and the same headers.
+// Mutations, subscriptions and requests with files are never coalesced.
+// When the context of the request that was sent is cancelled, the
+// requests that joined it fail too.
+func WithSingleflight() ClientOption {
+	return func(client *Client) {
+		client.flights = &flightGroup{}
+	}
+}
+
+// flightGroup tracks the requests in flight.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a request in flight, and its outcome once done is closed.
+type flight struct {
+	done          chan struct{}
+	res           *http.Response
+	body          []byte
+	failedAttempt int
+	err           error
+}
+
+// sendShared sends the request like send, or waits for the outcome of
+// an identical request already in flight.
+func (c *Client) sendShared(ctx context.Context, req *Request, header http.Header) (*http.Response, []byte, int, error) {
+	if c.flights == nil || len(req.files) > 0 || req.operationType() != "query" {
+		return c.send(ctx, req, header)
+	}
+	key := flightKey(req, header)
+	g := c.flights
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		c.logf(ctx, ">> joining identical request in flight")
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, nil, 0, ctx.Err()
+		}
+		if f.err != nil {
+			return nil, nil, f.failedAttempt, f.err
+		}
+		// callers may change the response, such as its body
+		res := *f.res
+		return &res, f.body, f.failedAttempt, nil
+	}
+	f := &flight{done: make(chan struct{})}
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	f.res, f.body, f.failedAttempt, f.err = c.send(ctx, req, header)
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+	close(f.done)
+	if f.err != nil {
+		return f.res, f.body, f.failedAttempt, f.err
+	}
+	res := *f.res
+	return &res, f.body, f.failedAttempt, nil
+}
+
+// flightKey identifies the encoded request and its headers.
+func flightKey(req *Request, header http.Header) string {
+	h := sha256.New()
+	h.Write([]byte(req.method + " " + req.url + "\n"))
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			h.Write([]byte(key + ": " + value + "\n"))
+		}
+	}
+	h.Write([]byte("\n"))
+	h.Write(req.body.Bytes())
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,116 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SubscribeSSE starts a subscription over Server-Sent Events using the
+// distinct connections mode of the graphql-sse protocol, which works
+// through proxies that block WebSockets:
+// https://github.com/enisdenjo/graphql-sse/blob/master/PROTOCOL.md
+// The request is sent to the endpoint of the client like Run, and the
+// returned channel receives a message for every next event. It is closed
+// when the server completes the subscription or ends the stream, after
+// a message carrying Err, or when ctx is cancelled.
+// Files are not supported, and middleware and retries don't apply.
+func (c *Client) SubscribeSSE(ctx context.Context, req *Request) (<-chan SubscriptionMessage, error) {
+	ctx = withRequestID(ctx)
+	if len(req.files) > 0 {
+		return nil, errors.New("cannot subscribe with files")
+	}
+	if err := c.configErr; err != nil {
+		return nil, err
+	}
+	req = req.runCopy()
+	if err := c.rewriteRequest(req); err != nil {
+		return nil, err
+	}
+	endpoint, err := c.resolveEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	req.endpoint = endpoint
+	res, body, err := c.openStream(ctx, req, "text/event-stream")
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan SubscriptionMessage)
+	go func() {
+		defer close(ch)
+		defer res.Body.Close()
+		c.readEvents(ctx, body, ch)
+	}()
+	return ch, nil
+}
+
+// readEvents delivers the next events of the stream to ch until it ends.
+func (c *Client) readEvents(ctx context.Context, body io.Reader, ch chan<- SubscriptionMessage) {
+	send := func(msg SubscriptionMessage) bool {
+		select {
+		case ch <- msg:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	r := bufio.NewReader(body)
+	var event string
+	var data bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err != io.EOF && ctx.Err() == nil {
+				send(SubscriptionMessage{Err: &NetworkError{Err: errors.Wrap(err, "reading event")}})
+			}
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			// the end of an event
+			if event == "complete" {
+				return
+			}
+			if (event == "" || event == "next") && data.Len() > 0 {
+				c.logf(ctx, "<< %s", data.String())
+				var result struct {
+					Data       json.RawMessage
+					Errors     Errors
+					Extensions map[string]interface{}
+				}
+				if err := json.Unmarshal(data.Bytes(), &result); err != nil {
+					send(SubscriptionMessage{Err: &DecodeError{Body: data.Bytes(), Err: err}})
+					return
+				}
+				if !send(SubscriptionMessage{Data: result.Data, Errors: result.Errors, Extensions: result.Extensions}) {
+					return
+				}
+			}
+			event = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// comment, sent to keep the connection alive
+		default:
+			field, value := line, ""
+			if i := strings.IndexByte(line, ':'); i >= 0 {
+				field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+			}
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				if data.Len() > 0 {
+					data.WriteByte('\n')
+				}
+				data.WriteString(value)
+			}
+		}
+	}
+}
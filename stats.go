@@ -0,0 +1,117 @@
+package graphql
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// statsReservoirSize is the number of durations kept to estimate the
+// percentiles of Stats.
+const statsReservoirSize = 1024
+
+// Stats summarizes the runs of a client using WithStats.
+type Stats struct {
+	// Requests is the number of runs, and Errors the number of runs
+	// that returned an error.
+	Requests int64
+	Errors   int64
+	// Min, Max and Avg are the shortest, longest and average duration of
+	// the runs, including retries.
+	Min time.Duration
+	Max time.Duration
+	Avg time.Duration
+	// P50 and P99 are the median and 99th percentile of the durations,
+	// estimated from a random sample of 1024 runs.
+	P50 time.Duration
+	P99 time.Duration
+}
+
+// WithStats makes the client keep the counts and durations of its runs,
+// as returned by Stats, for quick profiling and health checks without
+// a metrics system.
+func WithStats() ClientOption {
+	return func(client *Client) {
+		client.stats = &statsCollector{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	}
+}
+
+// Stats gets the statistics of the runs of the client since it was made.
+// It returns zero Stats when the client doesn't use WithStats.
+func (c *Client) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// statsCollector accumulates the durations of runs, keeping a uniform
+// sample of them in reservoir.
+type statsCollector struct {
+	mu        sync.Mutex
+	requests  int64
+	errors    int64
+	min       time.Duration
+	max       time.Duration
+	total     time.Duration
+	reservoir []time.Duration
+	rand      *rand.Rand
+}
+
+func (s *statsCollector) observe(dur time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if err != nil {
+		s.errors++
+	}
+	if s.requests == 1 || dur < s.min {
+		s.min = dur
+	}
+	if dur > s.max {
+		s.max = dur
+	}
+	s.total += dur
+	if len(s.reservoir) < statsReservoirSize {
+		s.reservoir = append(s.reservoir, dur)
+		return
+	}
+	if i := s.rand.Int63n(s.requests); i < statsReservoirSize {
+		s.reservoir[i] = dur
+	}
+}
+
+func (s *statsCollector) snapshot() Stats {
+	if s == nil {
+		return Stats{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.requests == 0 {
+		return Stats{}
+	}
+	sample := append([]time.Duration(nil), s.reservoir...)
+	sort.Slice(sample, func(i, j int) bool { return sample[i] < sample[j] })
+	return Stats{
+		Requests: s.requests,
+		Errors:   s.errors,
+		Min:      s.min,
+		Max:      s.max,
+		Avg:      s.total / time.Duration(s.requests),
+		P50:      percentile(sample, 0.50),
+		P99:      percentile(sample, 0.99),
+	}
+}
+
+// percentile gets the p-th percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,352 @@
+package graphql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Payload is a result received by RunStream: the initial result, or an
+// incremental result delivered for a @defer or @stream directive.
+type Payload struct {
+	// Data holds the data of the initial result merged with every
+	// incremental result received so far.
+	Data json.RawMessage
+	// Path is where the incremental result was merged in the data, and
+	// Label the label of the directive that delivered it. Both are
+	// empty for the initial result.
+	Path  []interface{}
+	Label string
+	// Errors holds any GraphQL errors reported with the result.
+	Errors Errors
+	// Extensions holds the extensions of the result.
+	Extensions map[string]interface{}
+	// HasNext tells whether more results will follow.
+	HasNext bool
+	// Err is set on the last payload when the stream failed for another
+	// reason than GraphQL errors, such as a lost connection.
+	Err error
+}
+
+// incrementalResult is a result of an incremental delivery response,
+// either of the initial format where each part carries a single result,
+// or of the format where results are listed in incremental.
+type incrementalResult struct {
+	Data        json.RawMessage
+	Items       json.RawMessage
+	Path        []interface{}
+	Label       string
+	Errors      Errors
+	Extensions  map[string]interface{}
+	HasNext     *bool
+	Incremental []incrementalResult
+}
+
+// RunStream executes a query using @defer or @stream and delivers the
+// results to the returned channel as the server streams them in a
+// multipart/mixed response. The data of each payload holds every result
+// received so far merged together.
+// The channel is closed after the payload whose HasNext is false, after
+// a payload carrying Err, or when ctx is cancelled. A server answering
+// with a single JSON result sends a single payload.
+// Files are not supported, and middleware and retries don't apply.
+func (c *Client) RunStream(ctx context.Context, req *Request) (<-chan Payload, error) {
+	ctx = withRequestID(ctx)
+	if len(req.files) > 0 {
+		return nil, errors.New("cannot stream requests with files")
+	}
+	if err := c.configErr; err != nil {
+		return nil, err
+	}
+	req = req.runCopy()
+	if err := c.rewriteRequest(req); err != nil {
+		return nil, err
+	}
+	endpoint, err := c.resolveEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	req.endpoint = endpoint
+	res, body, err := c.openStream(ctx, req, "multipart/mixed; deferSpec=20220824, application/json")
+	if err != nil {
+		return nil, err
+	}
+	mediaType, params, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	s := &stream{c: c, ctx: ctx}
+	ch := make(chan Payload)
+	go func() {
+		defer close(ch)
+		defer res.Body.Close()
+		if mediaType != "multipart/mixed" {
+			s.readJSON(body, ch)
+			return
+		}
+		s.readMultipart(multipart.NewReader(body, params["boundary"]), ch)
+	}()
+	return ch, nil
+}
+
+// openStream sends the request as JSON, accepting the given media types,
+// and returns the response and its body, decompressed, once the server
+// answered with 200 OK. The caller closes the body of the response.
+func (c *Client) openStream(ctx context.Context, req *Request, accept string) (*http.Response, io.Reader, error) {
+	if err := c.encodeJSONBody(ctx, req); err != nil {
+		return nil, nil, err
+	}
+	header, err := c.requestHeader(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Set("Accept", accept)
+	r, err := c.newHTTPRequest(ctx, req, header, bytes.NewReader(req.body.Bytes()))
+	if err != nil {
+		return nil, nil, err
+	}
+	c.logf(ctx, ">> headers: %v", c.redactHeader(r.Header))
+	res, err := c.httpClient.Do(r)
+	if err != nil {
+		return nil, nil, &NetworkError{Err: err}
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		c.logf(ctx, "<< %s", string(body))
+		return nil, nil, &StatusError{StatusCode: res.StatusCode, Body: body}
+	}
+	if err := c.checkEncoding(res); err != nil {
+		res.Body.Close()
+		return nil, nil, err
+	}
+	var body io.Reader = res.Body
+	if strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			res.Body.Close()
+			return nil, nil, errors.Wrap(err, "decompress body")
+		}
+		body = zr
+	}
+	return res, body, nil
+}
+
+// stream holds the state of the results of a RunStream.
+type stream struct {
+	c    *Client
+	ctx  context.Context
+	data interface{}
+}
+
+func (s *stream) send(ch chan<- Payload, p Payload) bool {
+	select {
+	case ch <- p:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+func (s *stream) readJSON(body io.Reader, ch chan<- Payload) {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		s.send(ch, Payload{Err: &NetworkError{Err: errors.Wrap(err, "reading body")}})
+		return
+	}
+	s.c.logf(s.ctx, "<< %s", string(b))
+	var result incrementalResult
+	if err := json.Unmarshal(b, &result); err != nil {
+		s.send(ch, Payload{Err: &DecodeError{Body: b, Err: err}})
+		return
+	}
+	result.HasNext = nil
+	s.deliver(result, ch)
+}
+
+func (s *stream) readMultipart(mr *multipart.Reader, ch chan<- Payload) {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			if s.ctx.Err() == nil {
+				s.send(ch, Payload{Err: &NetworkError{Err: errors.Wrap(err, "reading part")}})
+			}
+			return
+		}
+		b, err := ioutil.ReadAll(part)
+		if err != nil {
+			if s.ctx.Err() == nil {
+				s.send(ch, Payload{Err: &NetworkError{Err: errors.Wrap(err, "reading part")}})
+			}
+			return
+		}
+		s.c.logf(s.ctx, "<< %s", string(b))
+		if len(bytes.TrimSpace(b)) == 0 {
+			// heartbeat
+			continue
+		}
+		var result incrementalResult
+		if err := json.Unmarshal(b, &result); err != nil {
+			s.send(ch, Payload{Err: &DecodeError{Body: b, Err: err}})
+			return
+		}
+		if !s.deliver(result, ch) {
+			return
+		}
+	}
+}
+
+// deliver merges the result into the data and sends the payloads it
+// makes. It reports whether more results are expected.
+func (s *stream) deliver(result incrementalResult, ch chan<- Payload) bool {
+	hasNext := result.HasNext != nil && *result.HasNext
+	var results []incrementalResult
+	switch {
+	case len(result.Incremental) > 0:
+		results = result.Incremental
+		// errors and extensions of the response itself go with the
+		// last result
+		last := &results[len(results)-1]
+		last.Errors = append(last.Errors, result.Errors...)
+		if last.Extensions == nil {
+			last.Extensions = result.Extensions
+		}
+	case len(result.Data) == 0 && len(result.Items) == 0 && len(result.Errors) == 0 && result.Extensions == nil:
+		// a part only telling whether more results follow
+		if !hasNext {
+			s.sendData(ch, Payload{})
+		}
+		return hasNext
+	default:
+		results = []incrementalResult{result}
+	}
+	for i, r := range results {
+		if err := s.merge(r); err != nil {
+			s.send(ch, Payload{Err: err})
+			return false
+		}
+		p := Payload{
+			Path:       r.Path,
+			Label:      r.Label,
+			Errors:     r.Errors,
+			Extensions: r.Extensions,
+			HasNext:    hasNext || i < len(results)-1,
+		}
+		if !s.sendData(ch, p) {
+			return false
+		}
+	}
+	return hasNext
+}
+
+// sendData sends the payload with the merged data.
+func (s *stream) sendData(ch chan<- Payload, p Payload) bool {
+	data, err := json.Marshal(s.data)
+	if err != nil {
+		s.send(ch, Payload{Err: errors.Wrap(err, "encoding data")})
+		return false
+	}
+	p.Data = data
+	return s.send(ch, p)
+}
+
+// merge merges the data or items of the result into the data at the
+// path of the result.
+func (s *stream) merge(r incrementalResult) error {
+	decode := func(raw json.RawMessage) (interface{}, error) {
+		var v interface{}
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return nil, errors.Wrap(err, "decoding data")
+		}
+		return v, nil
+	}
+	switch {
+	case len(r.Items) > 0:
+		items, err := decode(r.Items)
+		if err != nil {
+			return err
+		}
+		list, ok := items.([]interface{})
+		if !ok || len(r.Path) == 0 {
+			return errors.New("graphql: invalid streamed items")
+		}
+		// the path of streamed items ends with the index of the first item
+		parent := r.Path[:len(r.Path)-1]
+		s.data, err = updateAt(s.data, parent, func(v interface{}) (interface{}, error) {
+			existing, _ := v.([]interface{})
+			return append(existing, list...), nil
+		})
+		return err
+	case len(r.Data) > 0 && string(r.Data) != "null":
+		data, err := decode(r.Data)
+		if err != nil {
+			return err
+		}
+		s.data, err = updateAt(s.data, r.Path, func(v interface{}) (interface{}, error) {
+			return mergeData(v, data), nil
+		})
+		return err
+	}
+	return nil
+}
+
+// updateAt replaces the node at path in data with the result of fn.
+func updateAt(data interface{}, path []interface{}, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	if len(path) == 0 {
+		return fn(data)
+	}
+	switch segment := path[0].(type) {
+	case string:
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("graphql: path segment %q is not an object", segment)
+		}
+		value, err := updateAt(object[segment], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		object[segment] = value
+		return object, nil
+	default:
+		n, ok := pathIndex(segment)
+		index := int(n)
+		list, isList := data.([]interface{})
+		if !ok || !isList || index < 0 || index >= len(list) {
+			return nil, fmt.Errorf("graphql: path segment %v is not a list index", segment)
+		}
+		value, err := updateAt(list[index], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		list[index] = value
+		return list, nil
+	}
+}
+
+// mergeData merges the fields of src into dst, recursively for objects.
+func mergeData(dst, src interface{}) interface{} {
+	dstObject, ok := dst.(map[string]interface{})
+	if !ok {
+		return src
+	}
+	srcObject, ok := src.(map[string]interface{})
+	if !ok {
+		return src
+	}
+	for key, value := range srcObject {
+		dstObject[key] = mergeData(dstObject[key], value)
+	}
+	return dstObject
+}
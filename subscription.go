@@ -0,0 +1,268 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// SubscriptionMessage is a message received for a subscription.
+type SubscriptionMessage struct {
+	// Data holds the data of the result, to be unmarshaled by the caller.
+	Data json.RawMessage
+	// Errors holds any GraphQL errors reported by the server.
+	Errors Errors
+	// Extensions holds the extensions of the result.
+	Extensions map[string]interface{}
+	// Err is set on the last message when the subscription failed
+	// for another reason than GraphQL errors, such as a lost connection.
+	Err error
+}
+
+// graphqlTransportWS is the WebSocket subprotocol spoken by Subscribe:
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const graphqlTransportWS = "graphql-transport-ws"
+
+// wsMessage is a message of the graphql-transport-ws protocol.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// WithSubscriptionInitPayload sets the payload of the connection_init
+// message sent by Subscribe, commonly used for authentication.
+func WithSubscriptionInitPayload(payload map[string]interface{}) ClientOption {
+	return func(client *Client) {
+		client.subscriptionInitPayload = payload
+	}
+}
+
+// Subscribe starts a subscription over a WebSocket connection using the
+// graphql-transport-ws protocol. The endpoint of the client is used with
+// its scheme changed to ws or wss, and the headers of the client and the
+// request are sent with the handshake. Subscribe fails when the server
+// doesn't acknowledge the connection within 10 seconds, or before ctx
+// is done, with a TimeoutError or a CanceledError like Run.
+// The returned channel receives a message for every result and is closed
+// when the server completes the subscription, after an error message, or
+// when ctx is cancelled.
+func (c *Client) Subscribe(ctx context.Context, req *Request) (<-chan SubscriptionMessage, error) {
+	ctx = withRequestID(ctx)
+	if err := c.configErr; err != nil {
+		return nil, err
+	}
+	req = req.runCopy()
+	if err := c.rewriteRequest(req); err != nil {
+		return nil, err
+	}
+	endpoint, err := c.resolveEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err = websocketURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	if err := c.addHeaders(ctx, req, header); err != nil {
+		return nil, err
+	}
+	dialer := &websocket.Dialer{
+		Proxy:        http.ProxyFromEnvironment,
+		Jar:          c.httpClient.Jar,
+		Subprotocols: []string{graphqlTransportWS},
+	}
+	if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+		dialer.Proxy = transport.Proxy
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+	c.logf(ctx, ">> subscribe: %s", endpoint)
+	conn, _, err := dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		return nil, contextError(ctx, errors.Wrap(err, "dial"))
+	}
+	s := &subscription{conn: conn}
+	if err := s.start(ctx, c, req); err != nil {
+		conn.Close()
+		return nil, contextError(ctx, err)
+	}
+	ch := make(chan SubscriptionMessage)
+	go s.read(ctx, c, ch)
+	return ch, nil
+}
+
+// websocketURL converts an http or https endpoint to ws or wss.
+func websocketURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", errors.Wrap(err, "parse endpoint")
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	return u.String(), nil
+}
+
+// subscription is a single subscription on its own connection.
+type subscription struct {
+	conn *websocket.Conn
+
+	// writeLock serializes writes, which the connection doesn't
+	// allow concurrently
+	writeLock sync.Mutex
+}
+
+// subscriptionID is the id of the only operation sent on a connection.
+const subscriptionID = "1"
+
+func (s *subscription) write(msgType string, payload interface{}) error {
+	msg := wsMessage{Type: msgType}
+	if msgType == "subscribe" || msgType == "complete" {
+		msg.ID = subscriptionID
+	}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return errors.Wrap(err, "encode payload")
+		}
+		msg.Payload = b
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return s.conn.WriteJSON(msg)
+}
+
+// defaultAckTimeout is how long the server has to acknowledge the
+// connection when ctx allows longer.
+const defaultAckTimeout = 10 * time.Second
+
+// start initialises the connection and sends the subscription.
+func (s *subscription) start(ctx context.Context, c *Client, req *Request) error {
+	deadline := time.Now().Add(defaultAckTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	s.conn.SetReadDeadline(deadline)
+	defer s.conn.SetReadDeadline(time.Time{})
+	// reading is only interrupted by the deadline, or by closing the
+	// connection once ctx is cancelled
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.conn.Close()
+		case <-stop:
+		}
+	}()
+	if err := s.write("connection_init", c.subscriptionInitPayload); err != nil {
+		return errors.Wrap(err, "connection_init")
+	}
+	for {
+		var msg wsMessage
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if ctx.Err() != nil {
+				return errors.Wrap(ctx.Err(), "waiting for connection_ack")
+			}
+			return errors.Wrap(err, "waiting for connection_ack")
+		}
+		if msg.Type == "ping" {
+			if err := s.write("pong", nil); err != nil {
+				return errors.Wrap(err, "pong")
+			}
+			continue
+		}
+		if msg.Type != "connection_ack" {
+			return errors.Errorf("graphql: unexpected %s message waiting for connection_ack", msg.Type)
+		}
+		break
+	}
+	payload := struct {
+		Query         string      `json:"query"`
+		Variables     interface{} `json:"variables,omitempty"`
+		OperationName string      `json:"operationName,omitempty"`
+	}{
+		Query:         req.q,
+		Variables:     req.variables(),
+		OperationName: req.OpName,
+	}
+	c.logf(ctx, ">> variables: %v", c.redactVariables(req.variableMap()))
+	c.logf(ctx, ">> query: %s", req.q)
+	if err := s.write("subscribe", payload); err != nil {
+		return errors.Wrap(err, "subscribe")
+	}
+	return nil
+}
+
+// read delivers the messages of the subscription to ch until it ends.
+func (s *subscription) read(ctx context.Context, c *Client, ch chan<- SubscriptionMessage) {
+	defer close(ch)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.write("complete", nil)
+		case <-done:
+		}
+		s.conn.Close()
+	}()
+	send := func(msg SubscriptionMessage) bool {
+		select {
+		case ch <- msg:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		var msg wsMessage
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if ctx.Err() == nil {
+				send(SubscriptionMessage{Err: errors.Wrap(err, "reading message")})
+			}
+			return
+		}
+		c.logf(ctx, "<< %s: %s", msg.Type, string(msg.Payload))
+		switch msg.Type {
+		case "next":
+			var result struct {
+				Data       json.RawMessage
+				Errors     Errors
+				Extensions map[string]interface{}
+			}
+			if err := json.Unmarshal(msg.Payload, &result); err != nil {
+				send(SubscriptionMessage{Err: errors.Wrap(err, "decoding message")})
+				return
+			}
+			if !send(SubscriptionMessage{Data: result.Data, Errors: result.Errors, Extensions: result.Extensions}) {
+				return
+			}
+		case "error":
+			var errs Errors
+			if err := json.Unmarshal(msg.Payload, &errs); err != nil {
+				send(SubscriptionMessage{Err: errors.Wrap(err, "decoding message")})
+				return
+			}
+			send(SubscriptionMessage{Errors: errs})
+			return
+		case "complete":
+			return
+		case "ping":
+			if err := s.write("pong", nil); err != nil {
+				send(SubscriptionMessage{Err: errors.Wrap(err, "pong")})
+				return
+			}
+		}
+	}
+}
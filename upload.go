@@ -0,0 +1,239 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// setMultipartBody sets the body of the request to the multipart form
+// written by fn, which calls writeFile to write the content of the file
+// at index i. The parts are separated by boundary, or by a random
+// boundary when it is empty.
+// Forms carrying files are streamed to the server while they are written
+// instead of being held in memory, with a Content-Length when the size
+// of every file is known.
+func (req *Request) setMultipartBody(ctx context.Context, boundary string, fn func(writer *multipart.Writer, writeFile func(dst io.Writer, i int) error) error) error {
+	proto := multipart.NewWriter(nil)
+	if boundary == "" {
+		boundary = proto.Boundary()
+	} else if err := proto.SetBoundary(boundary); err != nil {
+		return errors.Wrap(err, "set boundary")
+	}
+	write := func(w io.Writer, writeFile func(dst io.Writer, i int) error) error {
+		writer := multipart.NewWriter(w)
+		if err := writer.SetBoundary(boundary); err != nil {
+			return errors.Wrap(err, "set boundary")
+		}
+		if err := fn(writer, writeFile); err != nil {
+			return err
+		}
+		return errors.Wrap(writer.Close(), "close writer")
+	}
+	req.body = bytes.Buffer{}
+	req.contentType = proto.FormDataContentType()
+	req.writeBody = func(ctx context.Context, w io.Writer) error {
+		return write(w, func(dst io.Writer, i int) error {
+			src := req.files[i].R
+			if req.replay != nil {
+				src = req.replay[i].reader()
+			} else {
+				req.files[i].markConsumed()
+			}
+			if err := copyFile(ctx, dst, src); err != nil {
+				if ctx.Err() != nil {
+					req.abortFiles()
+					return ctx.Err()
+				}
+				return errors.Wrap(err, "preparing file")
+			}
+			return nil
+		})
+	}
+	if len(req.files) == 0 {
+		return req.bufferBody(ctx)
+	}
+	req.contentLength = -1
+	size, ok := filesSize(req.files)
+	if !ok {
+		return nil
+	}
+	var form countingWriter
+	if err := write(&form, func(io.Writer, int) error { return nil }); err != nil {
+		return err
+	}
+	req.contentLength = int64(form) + size
+	return nil
+}
+
+// bufferBody writes a streamed body into the body of the request, for
+// requests that are sent more than once or inspected.
+func (req *Request) bufferBody(ctx context.Context) error {
+	if req.writeBody == nil {
+		return nil
+	}
+	writeBody := req.writeBody
+	req.writeBody = nil
+	req.body = bytes.Buffer{}
+	return writeBody(ctx, &req.body)
+}
+
+// defaultReplayMemoryLimit is the size above which WithReplayableBody
+// keeps the content of a file in a temporary file rather than in memory.
+const defaultReplayMemoryLimit = 8 << 20
+
+// replayFile is the content of a file read once so that it can be sent
+// again, held in memory or, above the memory limit, in a temporary file.
+type replayFile struct {
+	mem  []byte
+	file *os.File
+	size int64
+}
+
+func (f replayFile) reader() io.Reader {
+	if f.file != nil {
+		return io.NewSectionReader(f.file, 0, f.size)
+	}
+	return bytes.NewReader(f.mem)
+}
+
+// bufferFiles reads the files of the request so that its streamed body
+// can be written again for each attempt.
+func (req *Request) bufferFiles(ctx context.Context, memoryLimit int64) error {
+	if req.replay != nil {
+		return nil
+	}
+	replay := make([]replayFile, 0, len(req.files))
+	for i, file := range req.files {
+		req.files[i].markConsumed()
+		f, err := readReplayFile(ctx, file.R, memoryLimit)
+		if err != nil {
+			for _, f := range replay {
+				f.remove()
+			}
+			if ctx.Err() != nil {
+				req.abortFiles()
+				return ctx.Err()
+			}
+			return errors.Wrap(err, "preparing file")
+		}
+		replay = append(replay, f)
+	}
+	req.replay = replay
+	return nil
+}
+
+func readReplayFile(ctx context.Context, r io.Reader, memoryLimit int64) (replayFile, error) {
+	var buf bytes.Buffer
+	if err := copyFile(ctx, &buf, io.LimitReader(r, memoryLimit+1)); err != nil {
+		return replayFile{}, err
+	}
+	if int64(buf.Len()) <= memoryLimit {
+		return replayFile{mem: buf.Bytes(), size: int64(buf.Len())}, nil
+	}
+	tmp, err := ioutil.TempFile("", "graphql-upload-")
+	if err != nil {
+		return replayFile{}, err
+	}
+	f := replayFile{file: tmp, size: int64(buf.Len())}
+	if _, err := buf.WriteTo(tmp); err != nil {
+		f.remove()
+		return replayFile{}, err
+	}
+	var rest countingWriter
+	if err := copyFile(ctx, io.MultiWriter(tmp, &rest), r); err != nil {
+		f.remove()
+		return replayFile{}, err
+	}
+	f.size += int64(rest)
+	return f, nil
+}
+
+// remove removes the temporary file holding the content, if any.
+func (f replayFile) remove() {
+	if f.file != nil {
+		f.file.Close()
+		os.Remove(f.file.Name())
+	}
+}
+
+// upload writes a streamed body into the pipe read by the transport.
+type upload struct {
+	r    *io.PipeReader
+	done chan struct{}
+	err  error
+}
+
+func (req *Request) startUpload(ctx context.Context) *upload {
+	pr, pw := io.Pipe()
+	u := &upload{r: pr, done: make(chan struct{})}
+	go func() {
+		defer close(u.done)
+		u.err = req.writeBody(ctx, pw)
+		pw.CloseWithError(u.err)
+	}()
+	return u
+}
+
+// wait stops the upload if the transport gave up reading it, and returns
+// the error that ended writing the body, other than the pipe being closed.
+func (u *upload) wait() error {
+	u.r.Close()
+	<-u.done
+	if errors.Cause(u.err) == io.ErrClosedPipe {
+		return nil
+	}
+	return u.err
+}
+
+// filesSize gets the total size of the content of the files, when it is
+// known without reading them.
+func filesSize(files []File) (int64, bool) {
+	var total int64
+	for _, file := range files {
+		switch r := file.R.(type) {
+		case interface{ Len() int }:
+			total += int64(r.Len())
+		case *os.File:
+			info, err := r.Stat()
+			if err != nil || !info.Mode().IsRegular() {
+				return 0, false
+			}
+			offset, err := r.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return 0, false
+			}
+			total += info.Size() - offset
+		case io.Seeker:
+			// the rest of the content, from the current offset
+			offset, err := r.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return 0, false
+			}
+			end, err := r.Seek(0, io.SeekEnd)
+			if err != nil {
+				return 0, false
+			}
+			if _, err := r.Seek(offset, io.SeekStart); err != nil {
+				return 0, false
+			}
+			total += end - offset
+		default:
+			return 0, false
+		}
+	}
+	return total, true
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
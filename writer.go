@@ -0,0 +1,260 @@
+package graphql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// RunToWriter executes the query and copies the data field of the result
+// to w as it is received, without holding the response in memory, for
+// results too large to be decoded at once. The data is written as sent
+// by the server, and is null when the operation failed.
+// GraphQL errors are returned once the whole response has been read, as
+// Errors like Run does.
+// Files are not supported, and middleware, retries and the limit set
+// with WithMaxResponseBytes don't apply.
+func (c *Client) RunToWriter(ctx context.Context, req *Request, w io.Writer) error {
+	ctx = withRequestID(ctx)
+	if len(req.files) > 0 {
+		return errors.New("cannot write the response of requests with files")
+	}
+	if err := c.configErr; err != nil {
+		return err
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	req = req.runCopy()
+	if err := c.rewriteRequest(req); err != nil {
+		return err
+	}
+	endpoint, err := c.resolveEndpoint(ctx, req)
+	if err != nil {
+		return err
+	}
+	req.endpoint = endpoint
+	res, body, err := c.openStream(ctx, req, "application/json")
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer res.Body.Close()
+	c.schemaVersion.observe(res.Header)
+	errs, err := c.copyData(bufio.NewReader(body), w)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// copyData scans the response object read from r, copying its data
+// field to w and decoding its errors field.
+func (c *Client) copyData(r *bufio.Reader, w io.Writer) (Errors, error) {
+	dataKey, errorsKey := "data", "errors"
+	if c.dataKey != "" {
+		dataKey = c.dataKey
+	}
+	if c.errorsKey != "" {
+		errorsKey = c.errorsKey
+	}
+	s := &jsonScanner{r: r}
+	ch, err := s.skipSpace()
+	if err != nil {
+		return nil, err
+	}
+	if ch != '{' {
+		return nil, s.syntaxError(ch)
+	}
+	var errs Errors
+	for {
+		ch, err := s.skipSpace()
+		if err != nil {
+			return nil, err
+		}
+		switch ch {
+		case '}':
+			return errs, nil
+		case ',':
+			continue
+		case '"':
+		default:
+			return nil, s.syntaxError(ch)
+		}
+		var rawKey bytes.Buffer
+		rawKey.WriteByte('"')
+		if err := s.copyString(&rawKey); err != nil {
+			return nil, err
+		}
+		var key string
+		if err := json.Unmarshal(rawKey.Bytes(), &key); err != nil {
+			return nil, &DecodeError{Body: rawKey.Bytes(), Err: err}
+		}
+		if ch, err := s.skipSpace(); err != nil {
+			return nil, err
+		} else if ch != ':' {
+			return nil, s.syntaxError(ch)
+		}
+		switch key {
+		case dataKey:
+			bw := bufio.NewWriter(w)
+			if err := s.copyValue(bw); err != nil {
+				return nil, err
+			}
+			if err := bw.Flush(); err != nil {
+				return nil, errors.Wrap(err, "write data")
+			}
+		case errorsKey:
+			var raw bytes.Buffer
+			if err := s.copyValue(&raw); err != nil {
+				return nil, err
+			}
+			var objects []json.RawMessage
+			if err := json.Unmarshal(raw.Bytes(), &objects); err != nil {
+				return nil, &DecodeError{Body: raw.Bytes(), Err: err}
+			}
+			errs = make(Errors, len(objects))
+			for i, object := range objects {
+				if err := json.Unmarshal(object, &errs[i]); err != nil {
+					return nil, &DecodeError{Body: raw.Bytes(), Err: err}
+				}
+				errs[i].Raw = object
+			}
+		default:
+			if err := s.copyValue(ioutil.Discard); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// jsonScanner copies JSON values from a reader without decoding them.
+type jsonScanner struct {
+	r *bufio.Reader
+}
+
+func (s *jsonScanner) next() (byte, error) {
+	ch, err := s.r.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, &NetworkError{Err: errors.Wrap(err, "reading body")}
+	}
+	return ch, nil
+}
+
+// skipSpace gets the next byte that is not white space.
+func (s *jsonScanner) skipSpace() (byte, error) {
+	for {
+		ch, err := s.next()
+		if err != nil {
+			return 0, err
+		}
+		switch ch {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return ch, nil
+		}
+	}
+}
+
+func (s *jsonScanner) syntaxError(ch byte) error {
+	return &DecodeError{Err: errors.Errorf("invalid character %q in response", ch)}
+}
+
+// copyString copies the rest of a string whose opening quote was read.
+func (s *jsonScanner) copyString(w io.Writer) error {
+	for {
+		ch, err := s.next()
+		if err != nil {
+			return err
+		}
+		if err := writeByte(w, ch); err != nil {
+			return err
+		}
+		switch ch {
+		case '"':
+			return nil
+		case '\\':
+			escaped, err := s.next()
+			if err != nil {
+				return err
+			}
+			if err := writeByte(w, escaped); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// copyValue copies the next value.
+func (s *jsonScanner) copyValue(w io.Writer) error {
+	ch, err := s.skipSpace()
+	if err != nil {
+		return err
+	}
+	switch {
+	case ch == '"':
+		if err := writeByte(w, ch); err != nil {
+			return err
+		}
+		return s.copyString(w)
+	case ch == '{' || ch == '[':
+		depth := 0
+		for {
+			if err := writeByte(w, ch); err != nil {
+				return err
+			}
+			switch ch {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			case '"':
+				if err := s.copyString(w); err != nil {
+					return err
+				}
+			}
+			if depth == 0 {
+				return nil
+			}
+			if ch, err = s.next(); err != nil {
+				return err
+			}
+		}
+	case ch == '-' || (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z'):
+		// number, true, false or null
+		for {
+			if err := writeByte(w, ch); err != nil {
+				return err
+			}
+			if ch, err = s.next(); err != nil {
+				return err
+			}
+			switch ch {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				return s.r.UnreadByte()
+			}
+		}
+	default:
+		return s.syntaxError(ch)
+	}
+}
+
+func writeByte(w io.Writer, ch byte) error {
+	if bw, ok := w.(io.ByteWriter); ok {
+		return bw.WriteByte(ch)
+	}
+	_, err := w.Write([]byte{ch})
+	return err
+}